@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/thewoolleyman/mcp-adapter-example/internal/bridge"
+	"github.com/thewoolleyman/mcp-adapter-example/internal/mcp"
+)
+
+// auditOptions are the --audit-* flags shared by proxy and serve.
+type auditOptions struct {
+	path      *string
+	maxMB     *int
+	keep      *int
+	arguments *string
+}
+
+func auditFlags(flags *flag.FlagSet) auditOptions {
+	return auditOptions{
+		path:      flags.String("audit-log", "", "append a JSONL audit entry for every tools/call to this file"),
+		maxMB:     flags.Int("audit-max-mb", 10, "rotate the audit log when it would grow past this many MB"),
+		keep:      flags.Int("audit-keep", 5, "rotated audit logs to keep"),
+		arguments: flags.String("audit-args", "hash", "log tool arguments as a SHA-256 hash (hash) or with secrets redacted (redacted)"),
+	}
+}
+
+// open returns nil when no audit log was requested. Secrets for redaction
+// come from the env, headers and auth of servers.
+func (o auditOptions) open(servers ...mcp.ServerConfig) *bridge.Auditor {
+	if *o.path == "" {
+		return nil
+	}
+	if *o.arguments != "hash" && *o.arguments != "redacted" {
+		fmt.Fprintf(os.Stderr, "Unknown --audit-args '%s' (expected hash or redacted)\n", *o.arguments)
+		os.Exit(2)
+	}
+	auditLog, err := bridge.OpenAuditLog(*o.path, int64(*o.maxMB)<<20, *o.keep)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return &bridge.Auditor{Log: auditLog, Redacted: *o.arguments == "redacted", Secrets: bridge.Secrets(servers...)}
+}
+
+// frontEnd wraps the client connections of proxy and serve. Auditing sits
+// inside the guard so that denied calls are logged.
+func frontEnd(auditor *bridge.Auditor, policy *mcp.Policy, resolve bridge.ToolResolver) func(bridge.Conn) bridge.Conn {
+	return func(conn bridge.Conn) bridge.Conn {
+		return bridge.Guard(auditor.Wrap(conn, resolve), policy, resolve)
+	}
+}
@@ -1,13 +1,30 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/thewoolleyman/mcp-adapter-example/internal/mcp"
 )
 
+const usage = `Usage:
+  mcp-bridge [generate] [--profile name]   generate client configs
+  mcp-bridge lint [--profile name]         check adapters against servers
+  mcp-bridge presets list                  show built-in presets
+  mcp-bridge proxy [--listen addr] (--url url | --server name | -- command args...)
+                                           bridge a server to stdio or HTTP
+  mcp-bridge serve [--servers a,b] [--listen addr]
+                                           serve all servers as one gateway
+  mcp-bridge record <server> -o session.jsonl
+                                           proxy a server on stdio, logging its traffic
+  mcp-bridge replay session.jsonl          answer on stdio from a recording
+  mcp-bridge status                        show the servers of running gateways
+`
+
 func main() {
 	// Locate repo root (assuming we run from repo root or a subdir,
 	// but for now let's assume CWD is repo root like the python script)
@@ -19,23 +36,72 @@ func main() {
 		os.Exit(1)
 	}
 
-	serversDir := filepath.Join(repoRoot, ".ai", "mcp", "servers")
-	adaptersDir := filepath.Join(repoRoot, ".ai", "mcp", "adapters")
-	outputPath := filepath.Join(repoRoot, ".mcp.json")
+	command := "generate"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
 
-	// Load Servers
-	servers, err := mcp.LoadServers(serversDir)
+	switch command {
+	case "generate":
+		generate(repoRoot, args)
+	case "lint":
+		lint(repoRoot, args)
+	case "presets":
+		presets(args)
+	case "proxy":
+		proxy(repoRoot, args)
+	case "serve":
+		serve(repoRoot, args)
+	case "record":
+		record(repoRoot, args)
+	case "replay":
+		replay(args)
+	case "status":
+		status(repoRoot, args)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command '%s'\n%s", command, usage)
+		os.Exit(2)
+	}
+}
+
+type workspace struct {
+	servers  map[string]mcp.ServerConfig
+	adapters []mcp.AdapterConfig
+	globals  mcp.Globals
+}
+
+// loadWorkspace registers --profile on flags, parses args and loads the
+// workspace.
+func loadWorkspace(repoRoot string, flags *flag.FlagSet, args []string) workspace {
+	profile := profileFlag(flags)
+	_ = flags.Parse(args)
+	return openWorkspace(repoRoot, *profile)
+}
+
+func profileFlag(flags *flag.FlagSet) *string {
+	return flags.String("profile", os.Getenv("MCP_PROFILE"), "vars profile to apply (.ai/mcp/vars.<profile>.json)")
+}
+
+// openWorkspace loads vars, servers and adapters from .ai/mcp under repoRoot.
+func openWorkspace(repoRoot string, profile string) workspace {
+	mcpDir := filepath.Join(repoRoot, ".ai", "mcp")
+	serversDir := filepath.Join(mcpDir, "servers")
+	adaptersDir := filepath.Join(mcpDir, "adapters")
+
+	// Load Vars
+	vars, err := mcp.LoadVars(mcpDir, profile)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading servers: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error loading vars: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Generate .mcp.json
-	if err := mcp.GenerateMCPJson(servers, outputPath); err != nil {
-		fmt.Fprintf(os.Stderr, "Error generating .mcp.json: %v\n", err)
+	// Load Servers
+	servers, err := mcp.LoadServers(serversDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading servers: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Printf("Successfully generated %s\n", outputPath)
 
 	// Load Adapters
 	adapters, err := mcp.LoadAdapters(adaptersDir)
@@ -44,46 +110,152 @@ func main() {
 		os.Exit(1)
 	}
 
+	return workspace{
+		servers:  servers,
+		adapters: adapters,
+		globals:  mcp.NewGlobals(repoRoot, vars),
+	}
+}
+
+// loadPolicy loads .ai/mcp/policy.json for proxy and serve, which are the
+// only commands that enforce it. With nil servers, as for a proxy to a URL
+// or command, the names under 'servers' are not checked.
+func loadPolicy(repoRoot string, servers map[string]mcp.ServerConfig, globals mcp.Globals) *mcp.Policy {
+	policy, err := mcp.LoadPolicy(filepath.Join(repoRoot, ".ai", "mcp"), servers, globals)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading policy: %v\n", err)
+		os.Exit(1)
+	}
+	return policy
+}
+
+func generate(repoRoot string, args []string) {
+	ws := loadWorkspace(repoRoot, flag.NewFlagSet("generate", flag.ExitOnError), args)
+	outputPath := filepath.Join(repoRoot, ".mcp.json")
+
+	// Generate .mcp.json
+	resolved, err := mcp.ResolveServers(ws.servers, ws.globals)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving servers: %v\n", err)
+		os.Exit(1)
+	}
+	if err := mcp.GenerateMCPJson(resolved, outputPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating .mcp.json: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Successfully generated %s\n", outputPath)
+
 	// Process Adapters
-	for _, adapter := range adapters {
+	for _, adapter := range ws.adapters {
 		if adapter.Tool == "" {
 			continue
 		}
 
-		toolConfig, err := mcp.ApplyAdapter(adapter, servers)
-
-		if err != nil {
+		if adapter.Type != "exec" && adapter.Template == "" {
+			entries, err := mcp.ApplyAdapterEntries(adapter, ws.servers, ws.globals)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error applying adapter for %s: %v\n", adapter.Tool, err)
+				os.Exit(1)
+			}
+			printWarnings(adapter, ws)
 
-			fmt.Fprintf(os.Stderr, "Error applying adapter for %s: %v\n", adapter.Tool, err)
+			written, err := mcp.GenerateToolConfig(adapter, entries, ws.globals)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error generating config for %s: %v\n", adapter.Tool, err)
+				os.Exit(1)
+			}
+			for _, path := range written {
+				fmt.Printf("Successfully generated %s\n", path)
+			}
+			continue
+		}
 
+		// Template and exec adapters render a single output path (defaulting to .mcp.<tool>.json)
+		toolOutputPath, err := adapter.ResolveOutputPath(ws.globals, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating config for %s: %v\n", adapter.Tool, err)
 			os.Exit(1)
-
 		}
+		globals := ws.globals.WithOutputDir(filepath.Dir(toolOutputPath))
 
-		// Determine output path: use adapter.OutputPath if present, else default to .mcp.<tool>.json
-
-		toolOutputPath := adapter.OutputPath
-
-		if toolOutputPath == "" {
-
-			toolOutputPath = fmt.Sprintf(".mcp.%s.json", adapter.Tool)
-
+		if adapter.Type == "exec" {
+			files, err := mcp.RunPlugin(adapter, ws.servers, globals, toolOutputPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error running plugin for %s: %v\n", adapter.Tool, err)
+				os.Exit(1)
+			}
+			for _, file := range files {
+				if err := mcp.WriteRendered(file.Path, file.Content); err != nil {
+					fmt.Fprintf(os.Stderr, "Error generating config for %s: %v\n", adapter.Tool, err)
+					os.Exit(1)
+				}
+				fmt.Printf("Successfully generated %s\n", file.Path)
+			}
+			continue
 		}
 
-		toolOutputPath = filepath.Join(repoRoot, toolOutputPath)
-
-		useTOML := adapter.FormatType == "toml"
-
-		if err := mcp.GenerateToolConfig(adapter.Tool, toolConfig, adapter.Format, toolOutputPath, useTOML); err != nil {
-
-			fmt.Fprintf(os.Stderr, "Error generating config for %s: %v\n", adapter.Tool, err)
+		if adapter.Template != "" {
+			content, err := mcp.RenderTemplate(adapter, ws.servers, globals)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error rendering template for %s: %v\n", adapter.Tool, err)
+				os.Exit(1)
+			}
+			if err := mcp.WriteRendered(toolOutputPath, content); err != nil {
+				fmt.Fprintf(os.Stderr, "Error generating config for %s: %v\n", adapter.Tool, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Successfully generated %s\n", toolOutputPath)
+		}
+	}
+}
 
-			os.Exit(1)
+func lint(repoRoot string, args []string) {
+	ws := loadWorkspace(repoRoot, flag.NewFlagSet("lint", flag.ExitOnError), args)
 
+	problems := mcp.Lint(ws.adapters, ws.servers, ws.globals)
+	for _, adapter := range ws.adapters {
+		if adapter.Tool != "" {
+			printWarnings(adapter, ws)
 		}
+	}
+	for _, problem := range problems {
+		fmt.Fprintf(os.Stderr, "%v\n", problem)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "Found %d problem(s)\n", len(problems))
+		os.Exit(1)
+	}
+	fmt.Printf("Checked %d adapter(s) against %d server(s): no problems found\n", len(ws.adapters), len(ws.servers))
+}
 
-		fmt.Printf("Successfully generated %s\n", toolOutputPath)
+// printWarnings reports canonical settings the adapter's client cannot express.
+// Selection errors are left to generation and lint to report.
+func printWarnings(adapter mcp.AdapterConfig, ws workspace) {
+	warnings, err := mcp.Warnings(adapter, ws.servers, ws.globals)
+	if err != nil {
+		return
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+}
 
+func presets(args []string) {
+	if len(args) != 1 || args[0] != "list" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
 	}
 
+	list, err := mcp.ListPresets()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading presets: %v\n", err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PRESET\tVERSION\tOUTPUT\tDESCRIPTION")
+	for _, preset := range list {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", preset.Name, preset.Version, preset.OutputPath, preset.Description)
+	}
+	_ = w.Flush()
 }
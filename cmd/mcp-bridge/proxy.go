@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/thewoolleyman/mcp-adapter-example/internal/bridge"
+	"github.com/thewoolleyman/mcp-adapter-example/internal/mcp"
+)
+
+// headerFlags collects repeated --header name:value flags. ${VAR}
+// references are kept, so that they are known to be secrets, and expanded
+// by expanded.
+type headerFlags map[string]string
+
+func (h headerFlags) expanded() map[string]string {
+	result := make(map[string]string, len(h))
+	for name, value := range h {
+		result[name] = bridge.ExpandEnv(value)
+	}
+	return result
+}
+
+func (h headerFlags) String() string { return "" }
+
+func (h headerFlags) Set(value string) error {
+	name, v, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("expected name:value, got '%s'", value)
+	}
+	h[strings.TrimSpace(name)] = strings.TrimSpace(v)
+	return nil
+}
+
+// proxy connects one MCP transport to another: the backend is a remote
+// endpoint (--url), a canonical server (--server) or a command after "--";
+// the front end is stdio, or streamable HTTP with --listen.
+func proxy(repoRoot string, args []string) {
+	flags := flag.NewFlagSet("proxy", flag.ExitOnError)
+	target := flags.String("url", "", "remote MCP endpoint to connect to")
+	transport := flags.String("transport", "http", "transport of --url: http (streamable HTTP) or sse")
+	headers := headerFlags{}
+	flags.Var(headers, "header", "name:value header sent to --url (repeatable)")
+	serverName := flags.String("server", "", "canonical server from .ai/mcp/servers to connect to")
+	listen := flags.String("listen", "", "serve streamable HTTP on this address (e.g. 127.0.0.1:8931) instead of stdio")
+	profile := profileFlag(flags)
+	audit := auditFlags(flags)
+	_ = flags.Parse(args)
+	command := flags.Args()
+
+	backends := 0
+	for _, set := range []bool{*target != "", *serverName != "", len(command) > 0} {
+		if set {
+			backends++
+		}
+	}
+	if backends != 1 {
+		fmt.Fprintf(os.Stderr, "proxy needs exactly one of --url, --server or a command after --\n%s", usage)
+		os.Exit(2)
+	}
+
+	var dial func() (bridge.Conn, error)
+	var name string
+	var policy *mcp.Policy
+	var definition mcp.ServerConfig
+	resolve := bridge.SingleServer("")
+	switch {
+	case *target != "":
+		name = *target
+		fields := map[string]interface{}{}
+		for header, value := range headers {
+			fields[header] = value
+		}
+		definition = mcp.ServerConfig{"headers": fields}
+		expanded := headers.expanded()
+		switch *transport {
+		case "http":
+			dial = func() (bridge.Conn, error) { return bridge.DialHTTP(*target, expanded), nil }
+		case "sse":
+			dial = func() (bridge.Conn, error) { return bridge.DialSSE(*target, expanded) }
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown transport '%s' (expected http or sse)\n", *transport)
+			os.Exit(2)
+		}
+	case *serverName != "":
+		name = *serverName
+		ws := openWorkspace(repoRoot, *profile)
+		policy = loadPolicy(repoRoot, ws.servers, ws.globals)
+		resolve = bridge.SingleServer(*serverName)
+		server, ok := ws.servers[*serverName]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Unknown server '%s'\n", *serverName)
+			os.Exit(1)
+		}
+		resolved, err := mcp.ResolveServer(server, ws.globals)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving server: %v\n", err)
+			os.Exit(1)
+		}
+		definition = resolved
+		dial = func() (bridge.Conn, error) { return bridge.Dial(resolved) }
+	default:
+		name = strings.Join(command, " ")
+		dial = func() (bridge.Conn, error) {
+			return bridge.Start(bridge.Command{Path: command[0], Args: command[1:]})
+		}
+	}
+
+	if *serverName == "" {
+		policy = loadPolicy(repoRoot, nil, mcp.NewGlobals(repoRoot, nil))
+	}
+
+	auditor := audit.open(definition)
+	if auditor != nil {
+		defer auditor.Log.Close()
+	}
+	front := frontEnd(auditor, policy, resolve)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *listen == "" {
+		backend, err := dial()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error connecting to %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		if err := bridge.Pipe(ctx, front(bridge.NewStdioConn(os.Stdin, os.Stdout, nil)), backend); err != nil {
+			fmt.Fprintf(os.Stderr, "Error proxying %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	handler := bridge.NewHTTPServer(func(conn bridge.Conn) {
+		backend, err := dial()
+		if err != nil {
+			log.Printf("Error connecting to %s: %v", name, err)
+			return
+		}
+		if err := bridge.Pipe(ctx, front(conn), backend); err != nil {
+			log.Printf("Error proxying %s: %v", name, err)
+		}
+	})
+	serveHTTP(ctx, *listen, handler, name)
+}
+
+// serveHTTP serves handler at /mcp on addr until ctx is done.
+func serveHTTP(ctx context.Context, addr string, handler *bridge.HTTPServer, name string) {
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", handler)
+	srv := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		handler.Close()
+		srv.Shutdown(context.Background())
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving %s on http://%s/mcp\n", name, addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error serving %s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/thewoolleyman/mcp-adapter-example/internal/bridge"
+	"github.com/thewoolleyman/mcp-adapter-example/internal/mcp"
+)
+
+// record runs a canonical server behind a stdio proxy and writes every
+// message exchanged with it to a JSONL file.
+func record(repoRoot string, args []string) {
+	flags := flag.NewFlagSet("record", flag.ExitOnError)
+	output := flags.String("o", "", "file to write the recording to (required)")
+	profile := profileFlag(flags)
+	serverName, args := leadingArg(args)
+	_ = flags.Parse(args)
+	if serverName == "" && flags.NArg() == 1 {
+		serverName = flags.Arg(0)
+	}
+	if serverName == "" || *output == "" {
+		fmt.Fprintf(os.Stderr, "record needs a server name and -o file\n%s", usage)
+		os.Exit(2)
+	}
+
+	ws := openWorkspace(repoRoot, *profile)
+	server, ok := ws.servers[serverName]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown server '%s'\n", serverName)
+		os.Exit(1)
+	}
+	resolved, err := mcp.ResolveServer(server, ws.globals)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving server: %v\n", err)
+		os.Exit(1)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating recording: %v\n", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	backend, err := bridge.Dial(resolved)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting to %s: %v\n", serverName, err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	recorder := bridge.NewRecorder(file)
+	front := recorder.Wrap(bridge.NewStdioConn(os.Stdin, os.Stdout, nil), bridge.ClientToServer)
+	if err := bridge.Pipe(ctx, front, recorder.Wrap(backend, bridge.ServerToClient)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error proxying %s: %v\n", serverName, err)
+		os.Exit(1)
+	}
+}
+
+// replay serves a recording on stdio as a fake server.
+func replay(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	path, args := leadingArg(args)
+	_ = flags.Parse(args)
+	if path == "" && flags.NArg() == 1 {
+		path = flags.Arg(0)
+	}
+	if path == "" {
+		fmt.Fprintf(os.Stderr, "replay needs a recording file\n%s", usage)
+		os.Exit(2)
+	}
+
+	recording, err := bridge.LoadRecording(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading recording: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := bridge.NewReplayer(recording).Serve(ctx, bridge.NewStdioConn(os.Stdin, os.Stdout, nil)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error replaying %s: %v\n", path, err)
+		os.Exit(1)
+	}
+}
+
+// leadingArg splits off a positional argument given before the flags.
+func leadingArg(args []string) (string, []string) {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		return args[0], args[1:]
+	}
+	return "", args
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/thewoolleyman/mcp-adapter-example/internal/bridge"
+	"github.com/thewoolleyman/mcp-adapter-example/internal/mcp"
+)
+
+// serve runs the gateway: every selected canonical server is started once
+// and exposed to clients as a single MCP server over stdio, or streamable
+// HTTP with --listen.
+func serve(repoRoot string, args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	only := flags.String("servers", "", "comma-separated servers to include (default: every enabled server)")
+	listen := flags.String("listen", "", "serve streamable HTTP on this address (e.g. 127.0.0.1:8931) instead of stdio")
+	audit := auditFlags(flags)
+	runDir := runDirFlag(flags, repoRoot)
+	ws := loadWorkspace(repoRoot, flags, args)
+	policy := loadPolicy(repoRoot, ws.servers, ws.globals)
+
+	names, err := gatewayServers(ws.servers, *only)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var backends []bridge.Backend
+	var definitions []mcp.ServerConfig
+	for _, name := range names {
+		resolved, err := mcp.ResolveServer(ws.servers[name], ws.globals)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving server '%s': %v\n", name, err)
+			os.Exit(1)
+		}
+		backends = append(backends, bridge.BackendFor(name, resolved, filepath.Join(*runDir, "logs")))
+		definitions = append(definitions, resolved)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	gateway := bridge.NewGateway(backends)
+	status := newStatusFile(*runDir, *listen, gateway)
+	gateway.OnStatusChange = status.write
+	if err := gateway.Start(ctx); err != nil {
+		status.remove()
+		fmt.Fprintf(os.Stderr, "Error starting gateway: %v\n", err)
+		os.Exit(1)
+	}
+	// Deferred calls run last first: the servers are stopped before the
+	// status file goes away.
+	defer status.remove()
+	defer gateway.Close()
+
+	auditor := audit.open(definitions...)
+	if auditor != nil {
+		defer auditor.Log.Close()
+	}
+	front := frontEnd(auditor, policy, gateway.ResolveTool)
+
+	if *listen == "" {
+		// A read from stdin is not always interrupted by closing it, so
+		// don't wait for Serve on a signal; the deferred Close still stops
+		// the servers.
+		served := make(chan error, 1)
+		go func() {
+			served <- gateway.Serve(ctx, front(bridge.NewStdioConn(os.Stdin, os.Stdout, nil)))
+		}()
+		select {
+		case err := <-served:
+			if err != nil && ctx.Err() == nil {
+				gateway.Close()
+				status.remove()
+				fmt.Fprintf(os.Stderr, "Error serving gateway: %v\n", err)
+				os.Exit(1)
+			}
+		case <-ctx.Done():
+		}
+		return
+	}
+
+	handler := bridge.NewHTTPServer(func(conn bridge.Conn) {
+		gateway.Serve(ctx, front(conn))
+	})
+	serveHTTP(ctx, *listen, handler, "gateway")
+}
+
+// gatewayServers returns the servers named in only, or every server not
+// marked enabled: false when only is empty, sorted by name.
+func gatewayServers(servers map[string]mcp.ServerConfig, only string) ([]string, error) {
+	var names []string
+	if only != "" {
+		for _, name := range strings.Split(only, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := servers[name]; !ok {
+				return nil, fmt.Errorf("unknown server '%s'", name)
+			}
+			names = append(names, name)
+		}
+	} else {
+		for name, server := range servers {
+			if enabled, ok := server["enabled"].(bool); ok && !enabled {
+				continue
+			}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/thewoolleyman/mcp-adapter-example/internal/bridge"
+)
+
+// gatewayState is the status file a running gateway keeps in its run
+// directory as gateway-<pid>.json.
+type gatewayState struct {
+	PID     int                    `json:"pid"`
+	Started time.Time              `json:"started"`
+	Listen  string                 `json:"listen"`
+	Servers []bridge.BackendStatus `json:"servers"`
+}
+
+func runDirFlag(flags *flag.FlagSet, repoRoot string) *string {
+	return flags.String("run-dir", filepath.Join(repoRoot, ".ai", "mcp", "run"), "directory for gateway status files and server logs")
+}
+
+// statusFile keeps a gateway's status file up to date.
+type statusFile struct {
+	gateway *bridge.Gateway
+
+	mu      sync.Mutex
+	path    string
+	state   gatewayState
+	removed bool
+}
+
+func newStatusFile(runDir, listen string, gateway *bridge.Gateway) *statusFile {
+	if listen == "" {
+		listen = "stdio"
+	}
+	pid := os.Getpid()
+	return &statusFile{
+		gateway: gateway,
+		path:    filepath.Join(runDir, fmt.Sprintf("gateway-%d.json", pid)),
+		state:   gatewayState{PID: pid, Started: time.Now().UTC(), Listen: listen},
+	}
+}
+
+// write saves the gateway's current status. The snapshot is taken under
+// f.mu, so that of two concurrent writes the later snapshot is saved last.
+func (f *statusFile) write() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.removed {
+		return
+	}
+	f.state.Servers = f.gateway.Status()
+	data, err := json.MarshalIndent(f.state, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing status: %v\n", err)
+		return
+	}
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing status: %v\n", err)
+		return
+	}
+	os.Rename(tmp, f.path)
+}
+
+func (f *statusFile) remove() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.removed = true
+	os.Remove(f.path)
+}
+
+// status prints the servers of every gateway running from this repo.
+// Status files left behind by gateways that died are removed.
+func status(repoRoot string, args []string) {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	runDir := runDirFlag(flags, repoRoot)
+	_ = flags.Parse(args)
+
+	paths, _ := filepath.Glob(filepath.Join(*runDir, "gateway-*.json"))
+	var states []gatewayState
+	for _, path := range paths {
+		var state gatewayState
+		data, err := os.ReadFile(path)
+		if err != nil || json.Unmarshal(data, &state) != nil {
+			continue
+		}
+		if !processAlive(state.PID) {
+			os.Remove(path)
+			continue
+		}
+		states = append(states, state)
+	}
+	if len(states) == 0 {
+		fmt.Println("No gateway is running")
+		return
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Started.Before(states[j].Started) })
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for i, state := range states {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "Gateway %d on %s, started %s\n", state.PID, state.Listen, state.Started.Local().Format(time.DateTime))
+		fmt.Fprintln(w, "SERVER\tSTATE\tPID\tRESTARTS\tSINCE\tLAST ERROR")
+		for _, server := range state.Servers {
+			pid := "-"
+			if server.PID != 0 {
+				pid = fmt.Sprint(server.PID)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", server.Name, server.State, pid, server.Restarts, server.Since.Local().Format(time.DateTime), server.LastError)
+		}
+	}
+	_ = w.Flush()
+}
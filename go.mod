@@ -2,4 +2,7 @@ module github.com/thewoolleyman/mcp-adapter-example
 
 go 1.24.6
 
-require github.com/pelletier/go-toml/v2 v2.2.4
+require (
+	github.com/pelletier/go-toml/v2 v2.2.4
+	gopkg.in/yaml.v3 v3.0.1
+)
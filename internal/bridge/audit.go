@@ -0,0 +1,345 @@
+package bridge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thewoolleyman/mcp-adapter-example/internal/mcp"
+)
+
+// Audit entry statuses.
+const (
+	AuditOK        = "ok"
+	AuditToolError = "tool_error"
+	AuditError     = "error"
+	AuditDenied    = "denied"
+	AuditCancelled = "cancelled"
+	AuditAbandoned = "abandoned"
+)
+
+// redacted replaces secrets in audited arguments.
+const redacted = "[REDACTED]"
+
+// AuditEntry is one line of the audit log, written when a tools/call is
+// answered or cancelled, or when the session ends before it is answered.
+type AuditEntry struct {
+	Time          time.Time              `json:"time"`
+	Client        string                 `json:"client"`
+	Server        string                 `json:"server"`
+	Tool          string                 `json:"tool"`
+	ArgumentsHash string                 `json:"arguments_sha256,omitempty"`
+	Arguments     map[string]interface{} `json:"arguments,omitempty"`
+	DurationMS    int64                  `json:"duration_ms"`
+	Status        string                 `json:"status"`
+	Error         string                 `json:"error,omitempty"`
+}
+
+// AuditLog appends entries to a JSONL file. When a write would take the
+// file past maxSize bytes, it is renamed to path.1 (path.1 to path.2, and
+// so on) and a new file started; only keep rotated files are kept.
+type AuditLog struct {
+	path    string
+	maxSize int64
+	keep    int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func OpenAuditLog(path string, maxSize int64, keep int) (*AuditLog, error) {
+	l := &AuditLog{path: path, maxSize: maxSize, keep: keep}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *AuditLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+func (l *AuditLog) Write(entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(data)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	return err
+}
+
+func (l *AuditLog) rotate() error {
+	l.file.Close()
+	os.Remove(fmt.Sprintf("%s.%d", l.path, l.keep))
+	for i := l.keep - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	if l.keep > 0 {
+		os.Rename(l.path, l.path+".1")
+	} else {
+		os.Remove(l.path)
+	}
+	return l.open()
+}
+
+func (l *AuditLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// Auditor logs the tools/call requests of the client connections it wraps.
+// Arguments are logged with Secrets replaced, or only as a SHA-256 hash of
+// the redacted arguments when Redacted is false.
+type Auditor struct {
+	Log      *AuditLog
+	Redacted bool
+	Secrets  []string
+}
+
+// credentialKey matches env, header and auth keys whose values are
+// credentials even when they are written out literally.
+var credentialKey = regexp.MustCompile(`(?i)token|key|secret|password|authorization`)
+
+// Secrets lists the credentials among the env and header values and auth
+// fields of canonical servers, for redaction: values that reference ${VAR}
+// (expanded, along with each variable's own value) and values of keys that
+// look like credentials. Other values, such as "true" or a path, are
+// ordinary configuration and left alone, as are values shorter than four
+// characters.
+func Secrets(servers ...mcp.ServerConfig) []string {
+	seen := map[string]bool{}
+	var secrets []string
+	add := func(value string) {
+		if len(value) >= 4 && !seen[value] {
+			seen[value] = true
+			secrets = append(secrets, value)
+		}
+	}
+	for _, server := range servers {
+		for _, field := range []string{"env", "headers", "auth"} {
+			values, _ := server[field].(map[string]interface{})
+			for key, value := range values {
+				raw, ok := value.(string)
+				if !ok {
+					continue
+				}
+				refs := envRef.FindAllStringSubmatch(raw, -1)
+				if len(refs) == 0 && !credentialKey.MatchString(key) {
+					continue
+				}
+				add(ExpandEnv(raw))
+				for _, ref := range refs {
+					add(os.Getenv(ref[1]))
+				}
+			}
+		}
+	}
+	// Longest first, so a secret containing another is replaced whole.
+	sort.Slice(secrets, func(i, j int) bool {
+		if len(secrets[i]) != len(secrets[j]) {
+			return len(secrets[i]) > len(secrets[j])
+		}
+		return secrets[i] < secrets[j]
+	})
+	return secrets
+}
+
+// Wrap audits the client on conn. Wrap it inside Guard so that denied calls
+// are logged too.
+func (a *Auditor) Wrap(conn Conn, resolve ToolResolver) Conn {
+	if a == nil {
+		return conn
+	}
+	return &auditConn{Conn: conn, auditor: a, resolve: resolve, calls: map[string]*auditedCall{}}
+}
+
+type auditedCall struct {
+	start time.Time
+	entry AuditEntry
+}
+
+type auditConn struct {
+	Conn
+	auditor *Auditor
+	resolve ToolResolver
+
+	mu     sync.Mutex
+	client string
+	calls  map[string]*auditedCall
+}
+
+func (c *auditConn) Receive() (*Message, error) {
+	msg, err := c.Conn.Receive()
+	if err != nil {
+		c.abandon()
+		return msg, err
+	}
+	if msg.Method == "notifications/cancelled" {
+		var params struct {
+			RequestID json.RawMessage `json:"requestId"`
+			Reason    string          `json:"reason"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		c.mu.Lock()
+		call, ok := c.calls[idKey(params.RequestID)]
+		delete(c.calls, idKey(params.RequestID))
+		c.mu.Unlock()
+		if ok {
+			c.write(call, AuditCancelled, params.Reason)
+		}
+	}
+	if !msg.IsRequest() {
+		return msg, nil
+	}
+	switch msg.Method {
+	case "initialize":
+		var params struct {
+			ClientInfo struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"clientInfo"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		c.mu.Lock()
+		c.client = strings.TrimSpace(params.ClientInfo.Name + " " + params.ClientInfo.Version)
+		c.mu.Unlock()
+	case "tools/call":
+		var params struct {
+			Name      string                 `json:"name"`
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		server, tool, ok := c.resolve(params.Name)
+		if !ok {
+			tool = params.Name
+		}
+		call := &auditedCall{start: time.Now(), entry: AuditEntry{Server: server, Tool: tool}}
+		arguments, _ := c.auditor.redact(params.Arguments).(map[string]interface{})
+		if c.auditor.Redacted {
+			call.entry.Arguments = arguments
+		} else {
+			data, _ := json.Marshal(arguments)
+			sum := sha256.Sum256(data)
+			call.entry.ArgumentsHash = hex.EncodeToString(sum[:])
+		}
+		c.mu.Lock()
+		call.entry.Client = c.client
+		c.calls[idKey(msg.ID)] = call
+		c.mu.Unlock()
+	}
+	return msg, nil
+}
+
+func (c *auditConn) Send(ctx context.Context, msg *Message) error {
+	if msg.IsResponse() {
+		c.mu.Lock()
+		call, ok := c.calls[idKey(msg.ID)]
+		delete(c.calls, idKey(msg.ID))
+		c.mu.Unlock()
+		if ok {
+			c.finish(call, msg)
+		}
+	}
+	return c.Conn.Send(ctx, msg)
+}
+
+func (c *auditConn) Close() error {
+	c.abandon()
+	return c.Conn.Close()
+}
+
+func (c *auditConn) finish(call *auditedCall, response *Message) {
+	switch {
+	case response.Error != nil && response.Error.Code == CodePolicyDenied:
+		c.write(call, AuditDenied, response.Error.Message)
+	case response.Error != nil:
+		c.write(call, AuditError, response.Error.Message)
+	default:
+		var result struct {
+			IsError bool `json:"isError"`
+		}
+		if json.Unmarshal(response.Result, &result) == nil && result.IsError {
+			c.write(call, AuditToolError, "")
+		} else {
+			c.write(call, AuditOK, "")
+		}
+	}
+}
+
+// abandon logs the calls still waiting for a response, which they will
+// not get once the session has ended.
+func (c *auditConn) abandon() {
+	c.mu.Lock()
+	calls := c.calls
+	c.calls = map[string]*auditedCall{}
+	c.mu.Unlock()
+	for _, call := range calls {
+		c.write(call, AuditAbandoned, "")
+	}
+}
+
+func (c *auditConn) write(call *auditedCall, status, message string) {
+	entry := call.entry
+	entry.Time = call.start.UTC()
+	entry.DurationMS = time.Since(call.start).Milliseconds()
+	entry.Status, entry.Error = status, message
+	if err := c.auditor.Log.Write(entry); err != nil {
+		log.Printf("writing audit log: %v", err)
+	}
+}
+
+// redact returns value with every secret in its strings replaced.
+func (a *Auditor) redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		for _, secret := range a.Secrets {
+			v = strings.ReplaceAll(v, secret, redacted)
+		}
+		return v
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = a.redact(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = a.redact(item)
+		}
+		return result
+	default:
+		return value
+	}
+}
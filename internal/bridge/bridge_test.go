@@ -0,0 +1,1181 @@
+package bridge
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thewoolleyman/mcp-adapter-example/internal/mcp"
+)
+
+// TestHelperServer is not a real test: it runs as a minimal MCP stdio
+// server when invoked by helperCommand. Its tools are named in
+// MCP_TEST_TOOLS, "echo" by default, and all of them echo. Resources named
+// in MCP_TEST_RESOURCES read as the server's name. A call with the
+// argument wait is left unanswered until it is cancelled, which the server
+// reports as a "cancelled" log message.
+func TestHelperServer(t *testing.T) {
+	if os.Getenv("MCP_TEST_SERVER") != "1" {
+		return
+	}
+	conn := NewStdioConn(os.Stdin, os.Stdout, nil)
+	ctx := context.Background()
+	var waiting json.RawMessage
+	for {
+		msg, err := conn.Receive()
+		if err != nil {
+			os.Exit(0)
+		}
+		if msg.Method == "notifications/cancelled" {
+			var params struct {
+				RequestID json.RawMessage `json:"requestId"`
+			}
+			json.Unmarshal(msg.Params, &params)
+			if waiting != nil && idKey(params.RequestID) == idKey(waiting) {
+				conn.Send(ctx, &Message{JSONRPC: "2.0", Method: "notifications/message", Params: json.RawMessage(`{"level":"info","data":"cancelled"}`)})
+			}
+			continue
+		}
+		if !msg.IsRequest() {
+			continue
+		}
+		var response *Message
+		switch msg.Method {
+		case "initialize":
+			capabilities := map[string]interface{}{"tools": map[string]interface{}{}}
+			if os.Getenv("MCP_TEST_RESOURCES") != "" {
+				capabilities["resources"] = map[string]interface{}{}
+			}
+			response, _ = NewResult(msg.ID, map[string]interface{}{
+				"protocolVersion": "2025-06-18",
+				"capabilities":    capabilities,
+				"serverInfo":      map[string]interface{}{"name": os.Getenv("MCP_TEST_NAME")},
+			})
+		case "resources/list":
+			var resources []interface{}
+			for _, uri := range strings.Split(os.Getenv("MCP_TEST_RESOURCES"), ",") {
+				resources = append(resources, map[string]interface{}{"uri": uri, "name": uri})
+			}
+			response, _ = NewResult(msg.ID, map[string]interface{}{"resources": resources})
+		case "resources/templates/list":
+			response, _ = NewResult(msg.ID, map[string]interface{}{"resourceTemplates": []interface{}{}})
+		case "resources/read":
+			var params struct {
+				URI string `json:"uri"`
+			}
+			json.Unmarshal(msg.Params, &params)
+			response, _ = NewResult(msg.ID, map[string]interface{}{
+				"contents": []interface{}{map[string]interface{}{"uri": params.URI, "text": os.Getenv("MCP_TEST_NAME")}},
+			})
+		case "tools/list":
+			names := []string{"echo"}
+			if extra := os.Getenv("MCP_TEST_TOOLS"); extra != "" {
+				names = strings.Split(extra, ",")
+			}
+			var tools []interface{}
+			for _, name := range names {
+				tools = append(tools, map[string]interface{}{"name": name, "inputSchema": map[string]interface{}{"type": "object"}})
+			}
+			response, _ = NewResult(msg.ID, map[string]interface{}{"tools": tools})
+		case "tools/call":
+			var params struct {
+				Name      string                 `json:"name"`
+				Arguments map[string]interface{} `json:"arguments"`
+				Meta      struct {
+					ProgressToken json.RawMessage `json:"progressToken"`
+				} `json:"_meta"`
+			}
+			json.Unmarshal(msg.Params, &params)
+			if params.Arguments["crash"] == true {
+				os.Exit(3)
+			}
+			if params.Arguments["wait"] == true {
+				waiting = msg.ID
+				continue
+			}
+			if params.Meta.ProgressToken != nil {
+				progress, _ := json.Marshal(map[string]interface{}{"progressToken": params.Meta.ProgressToken, "progress": 1})
+				conn.Send(ctx, &Message{JSONRPC: "2.0", Method: "notifications/progress", Params: progress})
+			}
+			conn.Send(ctx, &Message{JSONRPC: "2.0", Method: "notifications/message", Params: json.RawMessage(`{"level":"info","data":"echoing"}`)})
+			response, _ = NewResult(msg.ID, map[string]interface{}{
+				"content": []interface{}{map[string]interface{}{"type": "text", "text": fmt.Sprint(params.Arguments["text"])}},
+			})
+		default:
+			response = NewError(msg.ID, CodeMethodNotFound, "unknown method '%s'", msg.Method)
+		}
+		conn.Send(ctx, response)
+	}
+}
+
+func helperCommand(name string) Command {
+	return Command{
+		Path:   os.Args[0],
+		Args:   []string{"-test.run=^TestHelperServer$"},
+		Env:    map[string]string{"MCP_TEST_SERVER": "1", "MCP_TEST_NAME": name},
+		Stderr: io.Discard,
+	}
+}
+
+func mustRequest(t *testing.T, id interface{}, method string, params interface{}) *Message {
+	t.Helper()
+	msg, err := NewRequest(id, method, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// receiveUntil reads messages until one answers id, returning it and the
+// messages seen before it.
+func receiveUntil(t *testing.T, conn Conn, id string) (*Message, []*Message) {
+	t.Helper()
+	type result struct {
+		msg *Message
+		err error
+	}
+	var others []*Message
+	for {
+		ch := make(chan result, 1)
+		go func() {
+			msg, err := conn.Receive()
+			ch <- result{msg, err}
+		}()
+		select {
+		case r := <-ch:
+			if r.err != nil {
+				t.Fatalf("Receive failed: %v", r.err)
+			}
+			if r.msg.IsResponse() && string(r.msg.ID) == id {
+				return r.msg, others
+			}
+			others = append(others, r.msg)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Timed out waiting for response %s", id)
+		}
+	}
+}
+
+func TestStart_StdioServer(t *testing.T) {
+	process, err := Start(helperCommand("helper"))
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer process.Close()
+
+	if err := process.Send(context.Background(), mustRequest(t, 1, "initialize", map[string]interface{}{})); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	response, _ := receiveUntil(t, process, "1")
+	if !strings.Contains(string(response.Result), `"name":"helper"`) {
+		t.Errorf("Unexpected initialize result: %s", response.Result)
+	}
+
+	process.Close()
+	select {
+	case <-process.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Process did not exit after its stdin was closed")
+	}
+}
+
+// TestProxy_StdioToHTTPToStdio chains both directions of the proxy: a stdio
+// client talks to an HTTP endpoint that exposes a stdio server.
+func TestProxy_StdioToHTTPToStdio(t *testing.T) {
+	ctx := context.Background()
+	handler := NewHTTPServer(func(conn Conn) {
+		backend, err := Start(helperCommand("helper"))
+		if err != nil {
+			t.Errorf("Start failed: %v", err)
+			return
+		}
+		Pipe(ctx, conn, backend)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	defer handler.Close()
+
+	// The client's side of a stdio proxy: what it writes reaches the proxy's
+	// stdin and what the proxy prints reaches the client.
+	clientToProxy, proxyIn := io.Pipe()
+	proxyOut, proxyToClient := io.Pipe()
+	client := NewStdioConn(proxyOut, proxyIn, proxyIn)
+	front := NewStdioConn(clientToProxy, proxyToClient, proxyToClient)
+	remote := DialHTTP(server.URL, map[string]string{"X-Test": "1"})
+	go Pipe(ctx, front, remote)
+
+	client.Send(ctx, mustRequest(t, 1, "initialize", map[string]interface{}{"protocolVersion": "2025-06-18"}))
+	response, _ := receiveUntil(t, client, "1")
+	if response.Error != nil {
+		t.Fatalf("initialize failed: %v", response.Error)
+	}
+	if remote.sessionID == "" || remote.protocolVersion != "2025-06-18" {
+		t.Errorf("Expected a session and protocol version, got %q %q", remote.sessionID, remote.protocolVersion)
+	}
+	client.Send(ctx, &Message{JSONRPC: "2.0", Method: "notifications/initialized"})
+
+	client.Send(ctx, mustRequest(t, "call-1", "tools/call", map[string]interface{}{"name": "echo", "arguments": map[string]interface{}{"text": "hi"}}))
+	response, others := receiveUntil(t, client, `"call-1"`)
+	if !strings.Contains(string(response.Result), `"text":"hi"`) {
+		t.Errorf("Unexpected tools/call result: %s", response.Result)
+	}
+
+	// The server's notification travels over the GET stream, so it may
+	// arrive after the response.
+	if len(others) == 0 {
+		client.Send(ctx, mustRequest(t, 2, "tools/list", nil))
+		_, others = receiveUntil(t, client, "2")
+	}
+	if len(others) != 1 || others[0].Method != "notifications/message" {
+		t.Errorf("Expected the server's notification, got %+v", others)
+	}
+
+	client.Send(ctx, mustRequest(t, 3, "unknown/method", nil))
+	response, _ = receiveUntil(t, client, "3")
+	if response.Error == nil || response.Error.Code != CodeMethodNotFound {
+		t.Errorf("Expected method not found to pass through, got %+v", response)
+	}
+
+	client.Close()
+}
+
+func TestHTTPServer_Sessions(t *testing.T) {
+	handler := NewHTTPServer(func(conn Conn) {
+		backend, err := Start(helperCommand("helper"))
+		if err != nil {
+			return
+		}
+		Pipe(context.Background(), conn, backend)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	defer handler.Close()
+
+	post := func(sessionID string, body string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if sessionID != "" {
+			req.Header.Set(sessionHeader, sessionID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := post("", `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a session, got %d", resp.StatusCode)
+	}
+	if resp := post("nope", `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown session, got %d", resp.StatusCode)
+	}
+	if resp := post("", `{not json`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid JSON, got %d", resp.StatusCode)
+	}
+
+	resp := post("", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+	sessionID := resp.Header.Get(sessionHeader)
+	if sessionID == "" {
+		t.Fatal("Expected a session ID from initialize")
+	}
+	if resp := post(sessionID, `{"jsonrpc":"2.0","method":"notifications/initialized"}`); resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Expected 202 for a notification, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, server.URL, nil)
+	req.Header.Set(sessionHeader, sessionID)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected session deletion to succeed, got %v %v", resp, err)
+	}
+	if resp := post(sessionID, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 after deletion, got %d", resp.StatusCode)
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, server.URL, strings.NewReader(`{}`))
+	req.Header.Set("Origin", "https://evil.example")
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected a foreign origin to be rejected, got %v %v", resp, err)
+	}
+}
+
+// TestHTTPServer_IdleSessions checks that a request for the client that
+// cannot be delivered is answered with an error, and that an idle session
+// is closed.
+func TestHTTPServer_IdleSessions(t *testing.T) {
+	answered := make(chan *Message, 1)
+	ended := make(chan struct{})
+	handler := NewHTTPServer(func(conn Conn) {
+		defer close(ended)
+		for {
+			msg, err := conn.Receive()
+			if err != nil {
+				return
+			}
+			switch {
+			case msg.Method == "initialize":
+				response, _ := NewResult(msg.ID, map[string]interface{}{})
+				conn.Send(context.Background(), response)
+			case msg.Method == "notifications/initialized":
+				conn.Send(context.Background(), mustRequest(t, "s1", "roots/list", nil))
+			case msg.IsResponse():
+				answered <- msg
+			}
+		}
+	})
+	handler.IdleTimeout = 100 * time.Millisecond
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	defer handler.Close()
+
+	post := func(sessionID string, body string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if sessionID != "" {
+			req.Header.Set(sessionHeader, sessionID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	sessionID := post("", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`).Header.Get(sessionHeader)
+	post(sessionID, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+
+	select {
+	case response := <-answered:
+		if string(response.ID) != `"s1"` || response.Error == nil || !strings.Contains(response.Error.Message, "no event stream") {
+			t.Errorf("Expected an error for the undelivered request, got %+v", response)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The undelivered request was never answered")
+	}
+
+	select {
+	case <-ended:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The idle session was not closed")
+	}
+	if resp := post(sessionID, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an expired session, got %d", resp.StatusCode)
+	}
+}
+
+func TestDialSSE_LegacyServer(t *testing.T) {
+	events := make(chan string, 4)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: endpoint\ndata: /messages?session=1\n\n")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case data := <-events:
+				fmt.Fprintf(w, ": keep-alive\n\nevent: message\ndata: %s\n\n", data)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("session") != "1" || r.Header.Get("Authorization") != "Bearer t" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var msg Message
+		json.NewDecoder(r.Body).Decode(&msg)
+		response, _ := NewResult(msg.ID, map[string]string{"echo": msg.Method})
+		data, _ := json.Marshal(response)
+		events <- string(data)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	conn, err := DialSSE(server.URL+"/sse", map[string]string{"Authorization": "Bearer t"})
+	if err != nil {
+		t.Fatalf("DialSSE failed: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Send(context.Background(), mustRequest(t, 7, "ping", nil)); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	response, _ := receiveUntil(t, conn, "7")
+	if string(response.Result) != `{"echo":"ping"}` {
+		t.Errorf("Unexpected response: %s", response.Result)
+	}
+}
+
+// TestGateway_MergesAndRoutes serves two helper servers as one and checks
+// that their tools are namespaced and calls reach the right server.
+func TestGateway_MergesAndRoutes(t *testing.T) {
+	ctx := context.Background()
+	var backends []Backend
+	for _, name := range []string{"b", "a"} {
+		command := helperCommand(name)
+		backends = append(backends, Backend{Name: name, Dial: func() (Conn, error) { return Start(command) }, ToolPrefix: name + "__"})
+	}
+	backends = append(backends, Backend{Name: "broken", Dial: func() (Conn, error) {
+		return Start(Command{Path: "/nonexistent/mcp-server"})
+	}})
+	gateway := NewGateway(backends)
+	if err := gateway.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer gateway.Close()
+
+	clientToGateway, gatewayIn := io.Pipe()
+	gatewayOut, gatewayToClient := io.Pipe()
+	client := NewStdioConn(gatewayOut, gatewayIn, gatewayIn)
+	go gateway.Serve(ctx, NewStdioConn(clientToGateway, gatewayToClient, gatewayToClient))
+	defer client.Close()
+	defer gatewayOut.Close()
+
+	client.Send(ctx, mustRequest(t, 1, "initialize", map[string]interface{}{"protocolVersion": "2025-03-26"}))
+	response, _ := receiveUntil(t, client, "1")
+	if !strings.Contains(string(response.Result), `"protocolVersion":"2025-03-26"`) {
+		t.Errorf("Expected the client's protocol version, got %s", response.Result)
+	}
+
+	client.Send(ctx, mustRequest(t, 2, "tools/list", nil))
+	response, _ = receiveUntil(t, client, "2")
+	var list struct {
+		Tools []struct {
+			Name string `json:"name"`
+		} `json:"tools"`
+	}
+	json.Unmarshal(response.Result, &list)
+	var names []string
+	for _, tool := range list.Tools {
+		names = append(names, tool.Name)
+	}
+	if strings.Join(names, ",") != "a__echo,b__echo" {
+		t.Errorf("Expected merged, namespaced tools, got %v", names)
+	}
+
+	client.Send(ctx, mustRequest(t, "call", "tools/call", map[string]interface{}{"name": "b__echo", "arguments": map[string]interface{}{"text": "hi"}}))
+	response, _ = receiveUntil(t, client, `"call"`)
+	if !strings.Contains(string(response.Result), `"text":"hi"`) {
+		t.Errorf("Unexpected tools/call result: %+v", response)
+	}
+
+	client.Send(ctx, mustRequest(t, 3, "tools/call", map[string]interface{}{"name": "echo"}))
+	response, _ = receiveUntil(t, client, "3")
+	if response.Error == nil || response.Error.Code != CodeInvalidParams {
+		t.Errorf("Expected an unknown tool error, got %+v", response)
+	}
+
+	// A backend that exits is dropped from the merged list.
+	client.Send(ctx, mustRequest(t, 4, "tools/call", map[string]interface{}{"name": "a__echo", "arguments": map[string]interface{}{"crash": true}}))
+	response, _ = receiveUntil(t, client, "4")
+	if response.Error == nil {
+		t.Errorf("Expected an error from the crashed server, got %s", response.Result)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for id := 5; ; id++ {
+		client.Send(ctx, mustRequest(t, id, "tools/list", nil))
+		response, _ = receiveUntil(t, client, fmt.Sprint(id))
+		if !strings.Contains(string(response.Result), "a__echo") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Crashed server's tools were not removed: %s", response.Result)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// TestGateway_RestartsCrashedServer checks that a stdio server that exits
+// is restarted, its stderr logged and its status reported.
+func TestGateway_RestartsCrashedServer(t *testing.T) {
+	ctx := context.Background()
+	logDir := t.TempDir()
+	server := mcp.ServerConfig{
+		"transport": "stdio",
+		"command":   os.Args[0],
+		"args":      []interface{}{"-test.run=^TestHelperServer$"},
+		"env":       map[string]interface{}{"MCP_TEST_SERVER": "1", "MCP_TEST_NAME": "a"},
+	}
+	gateway := NewGateway([]Backend{BackendFor("a", server, logDir)})
+	gateway.minBackoff, gateway.maxBackoff = 10*time.Millisecond, 10*time.Millisecond
+	if err := gateway.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer gateway.Close()
+	first := gateway.Status()[0]
+	if first.State != StateRunning || first.PID == 0 {
+		t.Fatalf("Expected a running server, got %+v", first)
+	}
+
+	clientToGateway, gatewayIn := io.Pipe()
+	gatewayOut, gatewayToClient := io.Pipe()
+	client := NewStdioConn(gatewayOut, gatewayIn, gatewayIn)
+	go gateway.Serve(ctx, NewStdioConn(clientToGateway, gatewayToClient, gatewayToClient))
+	defer client.Close()
+	defer gatewayOut.Close()
+
+	client.Send(ctx, mustRequest(t, 1, "tools/call", map[string]interface{}{"name": "a__echo", "arguments": map[string]interface{}{"crash": true}}))
+	receiveUntil(t, client, "1")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st := gateway.Status()[0]
+		if st.State == StateRunning && st.Restarts >= 1 {
+			if st.PID == first.PID {
+				t.Errorf("Expected a new process, still %d", st.PID)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Server was not restarted: %+v", st)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	client.Send(ctx, mustRequest(t, 2, "tools/call", map[string]interface{}{"name": "a__echo", "arguments": map[string]interface{}{"text": "back"}}))
+	response, _ := receiveUntil(t, client, "2")
+	if !strings.Contains(string(response.Result), `"text":"back"`) {
+		t.Errorf("Unexpected tools/call result after restart: %+v", response)
+	}
+
+	data, err := os.ReadFile(filepath.Join(logDir, "a.log"))
+	if err != nil {
+		t.Fatalf("Reading server log: %v", err)
+	}
+	if strings.Count(string(data), "starting server 'a'") != 2 || !strings.Contains(string(data), "exited: exit status 3") {
+		t.Errorf("Unexpected server log:\n%s", data)
+	}
+}
+
+// TestGateway_CancelAndProgress checks that a client's cancellation reaches
+// the backend under the backend's request ID and that progress goes only
+// to the session that asked for it.
+func TestGateway_CancelAndProgress(t *testing.T) {
+	ctx := context.Background()
+	command := helperCommand("a")
+	gateway := NewGateway([]Backend{{Name: "a", Dial: func() (Conn, error) { return Start(command) }}})
+	if err := gateway.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer gateway.Close()
+
+	session := func() Conn {
+		clientToGateway, gatewayIn := io.Pipe()
+		gatewayOut, gatewayToClient := io.Pipe()
+		go gateway.Serve(ctx, NewStdioConn(clientToGateway, gatewayToClient, gatewayToClient))
+		t.Cleanup(func() { gatewayOut.Close() })
+		return NewStdioConn(gatewayOut, gatewayIn, gatewayIn)
+	}
+	first, second := session(), session()
+	defer first.Close()
+	defer second.Close()
+	// The second session only listens.
+	var mu sync.Mutex
+	var received []*Message
+	go func() {
+		for {
+			msg, err := second.Receive()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			received = append(received, msg)
+			mu.Unlock()
+		}
+	}()
+
+	first.Send(ctx, mustRequest(t, "slow", "tools/call", map[string]interface{}{"name": "echo", "arguments": map[string]interface{}{"wait": true}}))
+	first.Send(ctx, &Message{JSONRPC: "2.0", Method: "notifications/cancelled", Params: json.RawMessage(`{"requestId":"slow"}`)})
+	deadline := time.Now().Add(5 * time.Second)
+	for id := 1; ; id++ {
+		first.Send(ctx, mustRequest(t, id, "ping", nil))
+		_, others := receiveUntil(t, first, fmt.Sprint(id))
+		done := false
+		for _, msg := range others {
+			if msg.IsResponse() {
+				t.Errorf("Expected no response to a cancelled request, got %+v", msg)
+			}
+			done = done || strings.Contains(string(msg.Params), `"cancelled"`)
+		}
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("The backend was not told about the cancellation")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	first.Send(ctx, mustRequest(t, "call", "tools/call", map[string]interface{}{
+		"name": "echo", "arguments": map[string]interface{}{"text": "hi"}, "_meta": map[string]interface{}{"progressToken": 7},
+	}))
+	_, others := receiveUntil(t, first, `"call"`)
+	var progress []*Message
+	for _, msg := range others {
+		if msg.Method == "notifications/progress" {
+			progress = append(progress, msg)
+		}
+	}
+	if len(progress) != 1 || !strings.Contains(string(progress[0].Params), `"progressToken":7`) {
+		t.Errorf("Expected progress with the client's token, got %+v", others)
+	}
+	// Anything sent to the second session about the call was sent before
+	// first got its response, so it has arrived once a ping is answered.
+	second.Send(ctx, mustRequest(t, "ping", "ping", nil))
+	for answered := false; !answered; time.Sleep(10 * time.Millisecond) {
+		mu.Lock()
+		for _, msg := range received {
+			answered = answered || (msg.IsResponse() && string(msg.ID) == `"ping"`)
+		}
+		mu.Unlock()
+		if time.Now().After(deadline.Add(5 * time.Second)) {
+			t.Fatal("Timed out waiting for the second session's ping")
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, msg := range received {
+		if msg.Method == "notifications/progress" {
+			t.Errorf("Progress reached another session: %s", msg.Params)
+		}
+	}
+}
+
+// TestGateway_StalledSession checks that a session which stops reading
+// does not hold up backends' messages to the others.
+func TestGateway_StalledSession(t *testing.T) {
+	ctx := context.Background()
+	command := helperCommand("a")
+	gateway := NewGateway([]Backend{{Name: "a", Dial: func() (Conn, error) { return Start(command) }}})
+	if err := gateway.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer gateway.Close()
+
+	session := func() Conn {
+		clientToGateway, gatewayIn := io.Pipe()
+		gatewayOut, gatewayToClient := io.Pipe()
+		go gateway.Serve(ctx, NewStdioConn(clientToGateway, gatewayToClient, gatewayToClient))
+		t.Cleanup(func() { gatewayOut.Close(); gatewayIn.Close() })
+		return NewStdioConn(gatewayOut, gatewayIn, gatewayIn)
+	}
+	session() // never read
+	active := session()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		gateway.mu.RLock()
+		n := len(gateway.sessions)
+		gateway.mu.RUnlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the sessions")
+		}
+	}
+
+	// Every echo is logged to all sessions, more than the stalled one can queue.
+	for id := 1; id <= sessionQueueSize+10; id++ {
+		result := make(chan error, 1)
+		go func() {
+			active.Send(ctx, mustRequest(t, id, "tools/call", map[string]interface{}{"name": "echo", "arguments": map[string]interface{}{"text": "hi"}}))
+			for {
+				msg, err := active.Receive()
+				if err != nil || msg.IsResponse() {
+					result <- err
+					return
+				}
+			}
+		}()
+		select {
+		case err := <-result:
+			if err != nil {
+				t.Fatalf("Receive failed: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Call %d was held up by the stalled session", id)
+		}
+	}
+}
+
+func TestGateway_ToolNames(t *testing.T) {
+	ctx := context.Background()
+	backend := func(name, prefix string, aliases map[string]string) Backend {
+		command := helperCommand(name)
+		return Backend{Name: name, Dial: func() (Conn, error) { return Start(command) }, ToolPrefix: prefix, ToolAliases: aliases}
+	}
+
+	gateway := NewGateway([]Backend{backend("a", "", nil), backend("b", "", nil), backend("c", "", nil)})
+	err := gateway.Start(ctx)
+	if err == nil {
+		gateway.Close()
+		t.Fatal("Expected colliding tool names to fail Start")
+	}
+	for _, want := range []string{"tool 'echo' is exposed by servers 'a' and 'b'", "tool 'echo' is exposed by servers 'a' and 'c'"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to report %q, got %v", want, err)
+		}
+	}
+
+	gateway = NewGateway([]Backend{backend("a", "", nil), backend("b", "b_", nil), backend("c", "", map[string]string{"echo": "shout"})})
+	if err := gateway.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer gateway.Close()
+	gateway.mu.RLock()
+	idx := gateway.index
+	gateway.mu.RUnlock()
+	want := map[string]route{"echo": {"a", "echo"}, "b_echo": {"b", "echo"}, "shout": {"c", "echo"}}
+	if !reflect.DeepEqual(idx.toolRoutes, want) {
+		t.Errorf("Expected routes %v, got %v", want, idx.toolRoutes)
+	}
+}
+
+// TestGateway_RuntimeCollision checks that a backend whose tools collide
+// with another's only after Start is disabled instead of being shadowed.
+func TestGateway_RuntimeCollision(t *testing.T) {
+	ctx := context.Background()
+	a := helperCommand("a")
+	b := helperCommand("b")
+	b.Env["MCP_TEST_TOOLS"] = "echo,extra"
+	dials := 0
+	gateway := NewGateway([]Backend{
+		{Name: "a", Dial: func() (Conn, error) { return Start(a) }},
+		{Name: "b", Dial: func() (Conn, error) {
+			// b is down at Start, so its collision shows up on restart.
+			if dials++; dials == 1 {
+				return nil, errors.New("not yet")
+			}
+			return Start(b)
+		}},
+	})
+	gateway.minBackoff, gateway.maxBackoff = 10*time.Millisecond, 10*time.Millisecond
+	if err := gateway.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer gateway.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	var st BackendStatus
+	for {
+		st = gateway.Status()[1]
+		if st.State == StateFailed || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st.State != StateFailed || !strings.Contains(st.LastError, "tool 'echo' is exposed by servers 'a' and 'b'") {
+		t.Fatalf("Expected b to fail with the collision, got %+v", st)
+	}
+
+	response := gateway.handle(ctx, mustRequest(t, 1, "tools/list", nil))
+	if !strings.Contains(string(response.Result), `"echo"`) || strings.Contains(string(response.Result), "extra") {
+		t.Errorf("Expected only a's tools to be listed, got %s", response.Result)
+	}
+	response = gateway.handle(ctx, mustRequest(t, 2, "tools/call", map[string]interface{}{"name": "extra"}))
+	if response.Error == nil || !strings.Contains(response.Error.Message, "server 'b' is disabled") {
+		t.Errorf("Expected calls to b to fail, got %+v", response)
+	}
+	response = gateway.handle(ctx, mustRequest(t, 3, "tools/call", map[string]interface{}{"name": "echo", "arguments": map[string]interface{}{"text": "a"}}))
+	if response.Error != nil {
+		t.Errorf("Expected echo to still reach a, got %+v", response.Error)
+	}
+}
+
+// TestGateway_ResourceCollision checks that two backends cannot expose the
+// same resource URI, at Start or later.
+func TestGateway_ResourceCollision(t *testing.T) {
+	ctx := context.Background()
+	a := helperCommand("a")
+	a.Env["MCP_TEST_RESOURCES"] = "file:///shared,file:///a"
+	b := helperCommand("b")
+	b.Env["MCP_TEST_RESOURCES"] = "file:///shared"
+
+	gateway := NewGateway([]Backend{
+		{Name: "a", Dial: func() (Conn, error) { return Start(a) }},
+		{Name: "b", Dial: func() (Conn, error) { return Start(b) }, ToolPrefix: "b_"},
+	})
+	err := gateway.Start(ctx)
+	if err == nil {
+		gateway.Close()
+		t.Fatal("Expected a shared resource to fail Start")
+	}
+	if !strings.Contains(err.Error(), "resource 'file:///shared' is exposed by servers 'a' and 'b'") {
+		t.Errorf("Expected the collision to be reported, got %v", err)
+	}
+
+	dials := 0
+	gateway = NewGateway([]Backend{
+		{Name: "a", Dial: func() (Conn, error) { return Start(a) }},
+		{Name: "b", Dial: func() (Conn, error) {
+			// b is down at Start, so its collision shows up on restart.
+			if dials++; dials == 1 {
+				return nil, errors.New("not yet")
+			}
+			return Start(b)
+		}, ToolPrefix: "b_"},
+	})
+	gateway.minBackoff, gateway.maxBackoff = 10*time.Millisecond, 10*time.Millisecond
+	if err := gateway.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer gateway.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	var st BackendStatus
+	for {
+		st = gateway.Status()[1]
+		if st.State == StateFailed || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st.State != StateFailed || !strings.Contains(st.LastError, "resource 'file:///shared' is exposed by servers 'a' and 'b'") {
+		t.Fatalf("Expected b to fail with the collision, got %+v", st)
+	}
+
+	response := gateway.handle(ctx, mustRequest(t, 1, "resources/list", nil))
+	if strings.Count(string(response.Result), `"uri":"file:///shared"`) != 1 {
+		t.Errorf("Expected the shared resource to be listed once, got %s", response.Result)
+	}
+	response = gateway.handle(ctx, mustRequest(t, 2, "resources/read", map[string]interface{}{"uri": "file:///shared"}))
+	if response.Error != nil || !strings.Contains(string(response.Result), `"text":"a"`) {
+		t.Errorf("Expected the read to reach a, got %+v", response)
+	}
+}
+
+func TestGuard_Policy(t *testing.T) {
+	mcpDir := t.TempDir()
+	policy := map[string]interface{}{
+		"rules": []interface{}{
+			map[string]interface{}{"tools": []interface{}{"ec*"}, "arguments": map[string]interface{}{"text": map[string]interface{}{"glob": "rm *"}}, "action": "deny", "reason": "no shell"},
+		},
+		"servers": map[string]interface{}{
+			"helper": []interface{}{
+				map[string]interface{}{"arguments": map[string]interface{}{"text": map[string]interface{}{"pattern": "^ask"}}, "action": "confirm"},
+			},
+		},
+	}
+	data, _ := json.Marshal(policy)
+	os.WriteFile(filepath.Join(mcpDir, "policy.json"), data, 0o644)
+	servers := map[string]mcp.ServerConfig{"helper": {"name": "helper", "transport": "stdio", "command": "helper"}}
+	loaded, err := mcp.LoadPolicy(mcpDir, servers, mcp.NewGlobals(mcpDir, nil))
+	if err != nil {
+		t.Fatalf("LoadPolicy failed: %v", err)
+	}
+
+	connect := func(capabilities map[string]interface{}) *StdioConn {
+		backend, err := Start(helperCommand("helper"))
+		if err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+		clientToProxy, proxyIn := io.Pipe()
+		proxyOut, proxyToClient := io.Pipe()
+		client := NewStdioConn(proxyOut, proxyIn, proxyIn)
+		front := NewStdioConn(clientToProxy, proxyToClient, proxyToClient)
+		go Pipe(context.Background(), Guard(front, loaded, SingleServer("helper")), backend)
+		client.Send(context.Background(), mustRequest(t, 0, "initialize", map[string]interface{}{"capabilities": capabilities}))
+		receiveUntil(t, client, "0")
+		return client
+	}
+	call := func(client *StdioConn, id int, text string) {
+		client.Send(context.Background(), mustRequest(t, id, "tools/call", map[string]interface{}{"name": "echo", "arguments": map[string]interface{}{"text": text}}))
+	}
+	// answer replies to the elicitation the guard sends before id's response.
+	answer := func(client *StdioConn, action string) {
+		msg, err := client.Receive()
+		if err != nil || msg.Method != "elicitation/create" {
+			t.Fatalf("Expected an elicitation request, got %+v, %v", msg, err)
+		}
+		response, _ := NewResult(msg.ID, map[string]interface{}{"action": action})
+		client.Send(context.Background(), response)
+	}
+
+	client := connect(map[string]interface{}{"elicitation": map[string]interface{}{}})
+	defer client.Close()
+
+	call(client, 1, "rm -rf build")
+	response, _ := receiveUntil(t, client, "1")
+	if response.Error == nil || response.Error.Code != CodePolicyDenied || !strings.Contains(response.Error.Message, "no shell") {
+		t.Errorf("Expected the call to be denied, got %+v", response)
+	}
+
+	call(client, 2, "ask first")
+	answer(client, "accept")
+	response, _ = receiveUntil(t, client, "2")
+	if !strings.Contains(string(response.Result), "ask first") {
+		t.Errorf("Expected the confirmed call to go through, got %+v", response)
+	}
+
+	call(client, 3, "ask again")
+	answer(client, "decline")
+	response, _ = receiveUntil(t, client, "3")
+	if response.Error == nil || response.Error.Code != CodePolicyDenied {
+		t.Errorf("Expected the declined call to be refused, got %+v", response)
+	}
+
+	call(client, 4, "hello")
+	response, _ = receiveUntil(t, client, "4")
+	if !strings.Contains(string(response.Result), "hello") {
+		t.Errorf("Expected an allowed call to go through, got %+v", response)
+	}
+
+	// Without elicitation, calls needing confirmation are refused.
+	plain := connect(map[string]interface{}{})
+	defer plain.Close()
+	call(plain, 1, "ask")
+	response, _ = receiveUntil(t, plain, "1")
+	if response.Error == nil || !strings.Contains(response.Error.Message, "needs confirmation") {
+		t.Errorf("Expected the call to be refused, got %+v", response)
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend, err := Start(helperCommand("recorded"))
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	clientToProxy, proxyIn := io.Pipe()
+	proxyOut, proxyToClient := io.Pipe()
+	client := NewStdioConn(proxyOut, proxyIn, proxyIn)
+	recorder := NewRecorder(file)
+	front := recorder.Wrap(NewStdioConn(clientToProxy, proxyToClient, proxyToClient), ClientToServer)
+	piped := make(chan error, 1)
+	go func() { piped <- Pipe(ctx, front, recorder.Wrap(backend, ServerToClient)) }()
+
+	client.Send(ctx, mustRequest(t, 1, "initialize", map[string]interface{}{}))
+	receiveUntil(t, client, "1")
+	client.Send(ctx, mustRequest(t, 2, "tools/call", map[string]interface{}{"name": "echo", "arguments": map[string]interface{}{"text": "one"}}))
+	receiveUntil(t, client, "2")
+	client.Send(ctx, mustRequest(t, 3, "tools/call", map[string]interface{}{"name": "echo", "arguments": map[string]interface{}{"text": "two"}}))
+	receiveUntil(t, client, "3")
+	client.Close()
+	<-piped
+	file.Close()
+
+	recording, err := LoadRecording(path)
+	if err != nil {
+		t.Fatalf("LoadRecording failed: %v", err)
+	}
+	if len(recording) != 8 || recording[0].Direction != ClientToServer || recording[0].Message.Method != "initialize" {
+		t.Fatalf("Unexpected recording: %+v", recording)
+	}
+
+	clientToReplay, replayIn := io.Pipe()
+	replayOut, replayToClient := io.Pipe()
+	client = NewStdioConn(replayOut, replayIn, replayIn)
+	go NewReplayer(recording).Serve(ctx, NewStdioConn(clientToReplay, replayToClient, replayToClient))
+	defer client.Close()
+
+	client.Send(ctx, mustRequest(t, "a", "initialize", map[string]interface{}{"clientInfo": "different"}))
+	response, _ := receiveUntil(t, client, `"a"`)
+	if !strings.Contains(string(response.Result), `"name":"recorded"`) {
+		t.Errorf("Unexpected replayed initialize: %s", response.Result)
+	}
+
+	// The request with the same params is preferred, and the notification
+	// sent while it ran is replayed first.
+	client.Send(ctx, mustRequest(t, "b", "tools/call", map[string]interface{}{"name": "echo", "arguments": map[string]interface{}{"text": "two"}}))
+	response, others := receiveUntil(t, client, `"b"`)
+	if !strings.Contains(string(response.Result), `"text":"two"`) {
+		t.Errorf("Expected the matching recorded response, got %s", response.Result)
+	}
+	if len(others) != 1 || others[0].Method != "notifications/message" {
+		t.Errorf("Expected the recorded notification, got %+v", others)
+	}
+
+	client.Send(ctx, mustRequest(t, "c", "resources/list", nil))
+	response, _ = receiveUntil(t, client, `"c"`)
+	if response.Error == nil {
+		t.Errorf("Expected an error for an unrecorded method, got %s", response.Result)
+	}
+}
+
+func TestAuditor(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	auditLog, err := OpenAuditLog(filepath.Join(dir, "audit.jsonl"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AUDIT_TEST_TOKEN", "tok-123456")
+	secrets := Secrets(mcp.ServerConfig{
+		"env":     map[string]interface{}{"TOKEN": "${AUDIT_TEST_TOKEN}", "DEBUG": "true", "MODE": "demo", "ROOT": "/srv/data"},
+		"headers": map[string]interface{}{"Authorization": "Bearer ${AUDIT_TEST_TOKEN}", "X-Api-Key": "literal-key", "X-Team": "info"},
+		"auth":    map[string]interface{}{"client_id": "app-id", "client_secret": "shh-secret"},
+	})
+	if !reflect.DeepEqual(secrets, []string{"Bearer tok-123456", "literal-key", "shh-secret", "tok-123456"}) {
+		t.Errorf("Unexpected secrets: %v", secrets)
+	}
+
+	mcpDir := t.TempDir()
+	os.WriteFile(filepath.Join(mcpDir, "policy.json"), []byte(`{"rules": [{"arguments": {"text": {"glob": "no"}}, "action": "deny"}]}`), 0o644)
+	policy, err := mcp.LoadPolicy(mcpDir, nil, mcp.NewGlobals(mcpDir, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// start proxies the helper for a client, closing done once the proxy
+	// has stopped.
+	start := func(auditor *Auditor) (client Conn, done chan struct{}) {
+		backend, err := Start(helperCommand("helper"))
+		if err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+		clientToProxy, proxyIn := io.Pipe()
+		proxyOut, proxyToClient := io.Pipe()
+		client = NewStdioConn(proxyOut, proxyIn, proxyIn)
+		resolve := SingleServer("helper")
+		front := Guard(auditor.Wrap(NewStdioConn(clientToProxy, proxyToClient, proxyToClient), resolve), policy, resolve)
+		done = make(chan struct{})
+		go func() {
+			Pipe(ctx, front, backend)
+			close(done)
+		}()
+		client.Send(ctx, mustRequest(t, 0, "initialize", map[string]interface{}{"clientInfo": map[string]interface{}{"name": "tester", "version": "2"}}))
+		receiveUntil(t, client, "0")
+		return client, done
+	}
+	run := func(auditor *Auditor, calls ...map[string]interface{}) {
+		client, done := start(auditor)
+		for i, arguments := range calls {
+			client.Send(ctx, mustRequest(t, i+1, "tools/call", map[string]interface{}{"name": "echo", "arguments": arguments}))
+			receiveUntil(t, client, fmt.Sprint(i+1))
+		}
+		client.Close()
+		<-done
+	}
+	run(&Auditor{Log: auditLog, Redacted: true, Secrets: secrets},
+		map[string]interface{}{"text": "token tok-123456", "flag": "true", "path": "/srv/data/demo"},
+		map[string]interface{}{"text": "no"},
+	)
+	run(&Auditor{Log: auditLog, Secrets: secrets}, map[string]interface{}{"text": "tok-123456"})
+
+	// A cancelled call is logged when the client cancels it, and one still
+	// unanswered when the server dies when the proxy stops.
+	client, done := start(&Auditor{Log: auditLog})
+	go func() {
+		for {
+			if _, err := client.Receive(); err != nil {
+				return
+			}
+		}
+	}()
+	client.Send(ctx, mustRequest(t, "slow", "tools/call", map[string]interface{}{"name": "echo", "arguments": map[string]interface{}{"wait": true}}))
+	client.Send(ctx, &Message{JSONRPC: "2.0", Method: "notifications/cancelled", Params: json.RawMessage(`{"requestId":"slow","reason":"user stopped it"}`)})
+	client.Send(ctx, mustRequest(t, "crash", "tools/call", map[string]interface{}{"name": "echo", "arguments": map[string]interface{}{"crash": true}}))
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The proxy did not stop when the server died")
+	}
+	client.Close()
+	auditLog.Close()
+
+	data, _ := os.ReadFile(filepath.Join(dir, "audit.jsonl"))
+	var entries []AuditEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry AuditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Invalid audit line %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 5 {
+		t.Fatalf("Expected 5 audit entries, got %d: %s", len(entries), data)
+	}
+	if e := entries[0]; e.Client != "tester 2" || e.Server != "helper" || e.Tool != "echo" || e.Status != AuditOK || e.Arguments["text"] != "token [REDACTED]" || e.Arguments["flag"] != "true" || e.Arguments["path"] != "/srv/data/demo" {
+		t.Errorf("Unexpected entry for an allowed call: %+v", e)
+	}
+	if e := entries[1]; e.Status != AuditDenied || e.Error == "" {
+		t.Errorf("Unexpected entry for a denied call: %+v", e)
+	}
+	sum := sha256.Sum256([]byte(`{"text":"[REDACTED]"}`))
+	if e := entries[2]; e.Arguments != nil || e.ArgumentsHash != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected only a hash of the redacted arguments, got %+v", e)
+	}
+	if e := entries[3]; e.Status != AuditCancelled || e.Error != "user stopped it" {
+		t.Errorf("Unexpected entry for a cancelled call: %+v", e)
+	}
+	if e := entries[4]; e.Status != AuditAbandoned {
+		t.Errorf("Unexpected entry for an unanswered call: %+v", e)
+	}
+	if strings.Contains(string(data), "tok-123456") {
+		t.Errorf("Secret leaked into the audit log: %s", data)
+	}
+}
+
+func TestAuditLog_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := OpenAuditLog(path, 300, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := auditLog.Write(AuditEntry{Tool: fmt.Sprintf("tool%d", i), Status: AuditOK}); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	auditLog.Close()
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil || info.Size() > 300 {
+			t.Errorf("Expected %s to exist within the size limit, got %v, %v", name, info, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected only 2 rotated files, got %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "tool9") {
+		t.Errorf("Expected the newest entry in the current file, got %s", data)
+	}
+}
+
+func TestReadSSE(t *testing.T) {
+	stream := "event: endpoint\r\ndata: /a\r\n\r\n: comment\n\ndata: line1\ndata: line2\nid: 4\n\n"
+	var got []string
+	err := readSSE(bufio.NewReader(strings.NewReader(stream)), func(event, data string) error {
+		got = append(got, event+"="+data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"endpoint=/a", "message=line1\nline2"}
+	if strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("BRIDGE_TEST_TOKEN", "secret")
+	if got := ExpandEnv("Bearer ${BRIDGE_TEST_TOKEN} $HOME ${UNSET_BRIDGE_VAR}"); got != "Bearer secret $HOME " {
+		t.Errorf("Unexpected expansion: %q", got)
+	}
+}
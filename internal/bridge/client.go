@@ -0,0 +1,140 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Client sends requests to an MCP server over a Conn and matches their
+// responses. Requests are given the client's own IDs, so messages from
+// several peers can be forwarded over one connection.
+type Client struct {
+	conn      Conn
+	onMessage func(*Message)
+	nextID    atomic.Int64
+
+	mu      sync.Mutex
+	pending map[string]chan *Message
+
+	done chan struct{}
+	err  error
+}
+
+// NewClient reads from conn until it fails. Notifications and requests the
+// server sends on its own are passed to onMessage, which may be nil and
+// must not block.
+func NewClient(conn Conn, onMessage func(*Message)) *Client {
+	c := &Client{
+		conn:      conn,
+		onMessage: onMessage,
+		pending:   map[string]chan *Message{},
+		done:      make(chan struct{}),
+	}
+	go c.read()
+	return c
+}
+
+func (c *Client) read() {
+	for {
+		msg, err := c.conn.Receive()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errors.New("server closed the connection")
+			}
+			c.err = err
+			close(c.done)
+			return
+		}
+		if msg.IsResponse() {
+			c.mu.Lock()
+			ch, ok := c.pending[idKey(msg.ID)]
+			delete(c.pending, idKey(msg.ID))
+			c.mu.Unlock()
+			if ok {
+				ch <- msg
+			}
+			continue
+		}
+		if c.onMessage != nil {
+			c.onMessage(msg)
+		}
+	}
+}
+
+// Call sends a request and waits for its response. A JSON-RPC error
+// response is returned as a message, not as an error.
+func (c *Client) Call(ctx context.Context, method string, params interface{}) (*Message, error) {
+	msg, err := NewRequest(0, method, params)
+	if err != nil {
+		return nil, err
+	}
+	return c.Forward(ctx, msg)
+}
+
+// Forward sends a copy of the request msg under a new ID and returns the
+// response with msg's original ID restored.
+func (c *Client) Forward(ctx context.Context, msg *Message) (*Message, error) {
+	id := json.RawMessage(strconv.FormatInt(c.nextID.Add(1), 10))
+	request := *msg
+	request.ID = id
+
+	ch := make(chan *Message, 1)
+	c.mu.Lock()
+	c.pending[idKey(id)] = ch
+	c.mu.Unlock()
+	release := func() {
+		c.mu.Lock()
+		delete(c.pending, idKey(id))
+		c.mu.Unlock()
+	}
+
+	if err := c.conn.Send(ctx, &request); err != nil {
+		release()
+		return nil, err
+	}
+	select {
+	case response := <-ch:
+		result := *response
+		result.ID = msg.ID
+		return &result, nil
+	case <-c.done:
+		release()
+		return nil, c.err
+	case <-ctx.Done():
+		release()
+		// Tell the server to stop working on the request.
+		go c.conn.Send(context.Background(), cancelled(id, ctx.Err()))
+		return nil, ctx.Err()
+	}
+}
+
+// cancelled is the notification that abandons the request with ID id.
+func cancelled(id json.RawMessage, reason error) *Message {
+	params, _ := json.Marshal(map[string]interface{}{"requestId": id, "reason": reason.Error()})
+	return &Message{JSONRPC: "2.0", Method: "notifications/cancelled", Params: params}
+}
+
+// Send sends a notification or a response.
+func (c *Client) Send(ctx context.Context, msg *Message) error {
+	return c.conn.Send(ctx, msg)
+}
+
+// Done is closed when the connection fails.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err waits for the connection to fail and returns why.
+func (c *Client) Err() error {
+	<-c.done
+	return c.err
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
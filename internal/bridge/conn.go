@@ -0,0 +1,113 @@
+package bridge
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// A Conn carries JSON-RPC messages to and from one MCP peer. Send may be
+// called concurrently; Receive is called from a single goroutine and
+// returns io.EOF once the peer has gone away.
+type Conn interface {
+	Send(ctx context.Context, msg *Message) error
+	Receive() (*Message, error)
+	Close() error
+}
+
+// maxLineSize bounds a single newline-delimited stdio message.
+const maxLineSize = 16 << 20
+
+// StdioConn speaks newline-delimited JSON-RPC over a reader and a writer,
+// as MCP's stdio transport does.
+type StdioConn struct {
+	scanner *bufio.Scanner
+	mu      sync.Mutex
+	w       io.Writer
+	closer  io.Closer
+}
+
+// NewStdioConn reads messages from r and writes them to w. closer, if not
+// nil, is closed by Close.
+func NewStdioConn(r io.Reader, w io.Writer, closer io.Closer) *StdioConn {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	return &StdioConn{scanner: scanner, w: w, closer: closer}
+}
+
+func (c *StdioConn) Send(ctx context.Context, msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = c.w.Write(append(data, '\n'))
+	return err
+}
+
+func (c *StdioConn) Receive() (*Message, error) {
+	for c.scanner.Scan() {
+		line := c.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			return nil, fmt.Errorf("invalid JSON-RPC message: %w", err)
+		}
+		return &msg, nil
+	}
+	if err := c.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (c *StdioConn) Close() error {
+	if c.closer == nil {
+		return nil
+	}
+	return c.closer.Close()
+}
+
+// Pipe copies messages between client and server in both directions until
+// either side closes or ctx is done, then closes both. A clean shutdown
+// returns nil.
+func Pipe(ctx context.Context, client, server Conn) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, 2)
+	copyMessages := func(from, to Conn) {
+		for {
+			msg, err := from.Receive()
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err := to.Send(ctx, msg); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}
+	go copyMessages(client, server)
+	go copyMessages(server, client)
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+	}
+	client.Close()
+	server.Close()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+package bridge
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/thewoolleyman/mcp-adapter-example/internal/mcp"
+)
+
+// envRef matches ${VAR} references in canonical env and header values.
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ExpandEnv replaces ${VAR} references with values from the bridge's
+// environment; unset variables expand to "".
+func ExpandEnv(s string) string {
+	return envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		return os.Getenv(envRef.FindStringSubmatch(ref)[1])
+	})
+}
+
+// Dial connects to a resolved canonical server definition: stdio servers
+// are started, http and sse servers are connected to.
+func Dial(server mcp.ServerConfig) (Conn, error) {
+	switch server["transport"] {
+	case "stdio":
+		command, err := CommandFor(server)
+		if err != nil {
+			return nil, err
+		}
+		return Start(command)
+	case "http":
+		url, _ := server["url"].(string)
+		return DialHTTP(url, stringMap(server["headers"])), nil
+	case "sse":
+		url, _ := server["url"].(string)
+		return DialSSE(url, stringMap(server["headers"]))
+	default:
+		return nil, fmt.Errorf("server '%v': unsupported transport '%v'", server["name"], server["transport"])
+	}
+}
+
+// BackendFor makes a gateway backend of a resolved canonical server. Its
+// tools are prefixed with "<name>__" unless the server sets tool_prefix.
+// When logDir is set, a stdio server's stderr is appended to
+// logDir/<name>.log.
+func BackendFor(name string, server mcp.ServerConfig, logDir string) Backend {
+	backend := Backend{
+		Name:       name,
+		Dial:       func() (Conn, error) { return Dial(server) },
+		ToolPrefix: name + namespaceSeparator,
+	}
+	if logDir != "" && server["transport"] == "stdio" {
+		backend.Dial = func() (Conn, error) { return startLogged(name, server, filepath.Join(logDir, name+".log")) }
+	}
+	if prefix, ok := server["tool_prefix"].(string); ok {
+		backend.ToolPrefix = prefix
+	}
+	if aliases, ok := server["tool_aliases"].(map[string]interface{}); ok {
+		backend.ToolAliases = map[string]string{}
+		for tool, alias := range aliases {
+			backend.ToolAliases[tool] = fmt.Sprint(alias)
+		}
+	}
+	return backend
+}
+
+// startLogged starts a stdio server with its stderr appended to logPath,
+// after a line marking the start.
+func startLogged(name string, server mcp.ServerConfig, logPath string) (Conn, error) {
+	command, err := CommandFor(server)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(logPath), 0o755); err != nil {
+		return nil, err
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(logFile, "--- mcp-bridge: starting server '%s' at %s\n", name, time.Now().UTC().Format(time.RFC3339))
+	command.Stderr = logFile
+	process, err := Start(command)
+	if err != nil {
+		fmt.Fprintf(logFile, "--- mcp-bridge: %v\n", err)
+		logFile.Close()
+		return nil, err
+	}
+	go func() {
+		<-process.Done()
+		fmt.Fprintf(logFile, "--- mcp-bridge: server '%s' exited: %v\n", name, exitStatus(process.Err()))
+		logFile.Close()
+	}()
+	return process, nil
+}
+
+func exitStatus(err error) string {
+	if err == nil {
+		return "exit status 0"
+	}
+	return err.Error()
+}
+
+// CommandFor builds the process for a canonical stdio server.
+func CommandFor(server mcp.ServerConfig) (Command, error) {
+	path, _ := server["command"].(string)
+	if path == "" {
+		return Command{}, fmt.Errorf("server '%v' is missing 'command'", server["name"])
+	}
+	command := Command{Path: path, Env: stringMap(server["env"])}
+	command.Dir, _ = server["cwd"].(string)
+	if args, ok := server["args"].([]interface{}); ok {
+		for _, arg := range args {
+			command.Args = append(command.Args, fmt.Sprint(arg))
+		}
+	}
+	return command, nil
+}
+
+// stringMap converts a canonical env or headers object, expanding ${VAR}
+// references.
+func stringMap(value interface{}) map[string]string {
+	fields, _ := value.(map[string]interface{})
+	result := make(map[string]string, len(fields))
+	for key, v := range fields {
+		result[key] = ExpandEnv(fmt.Sprint(v))
+	}
+	return result
+}
@@ -0,0 +1,918 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// protocolVersions are the MCP versions the gateway speaks, newest first.
+var protocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// namespaceSeparator joins a server name and a tool or prompt name in the
+// gateway's merged lists, e.g. "gitlab__get_issue".
+const namespaceSeparator = "__"
+
+// implementationVersion is reported as the gateway's serverInfo and
+// clientInfo version.
+const implementationVersion = "0.1.0"
+
+// initializeTimeout bounds a backend's initialize handshake.
+const initializeTimeout = 30 * time.Second
+
+// sessionQueueSize is how many messages may wait for a client session that
+// is slow to read before further notifications to it are dropped.
+const sessionQueueSize = 256
+
+// Backend is a server behind the gateway. Its tools are exposed as
+// ToolPrefix followed by the tool's name, or under the name given in
+// ToolAliases, which is not prefixed.
+type Backend struct {
+	Name        string
+	Dial        func() (Conn, error)
+	ToolPrefix  string
+	ToolAliases map[string]string
+}
+
+// toolName is the name a backend tool is exposed under.
+func (b Backend) toolName(name string) string {
+	if alias, ok := b.ToolAliases[name]; ok {
+		return alias
+	}
+	return b.ToolPrefix + name
+}
+
+// collision is a tool name, resource URI or resource template exposed by
+// two backends.
+type collision struct {
+	kind          string
+	name          string
+	first, second string
+}
+
+func (c collision) String() string {
+	return fmt.Sprintf("%s '%s' is exposed by servers '%s' and '%s'", c.kind, c.name, c.first, c.second)
+}
+
+// Gateway serves several MCP servers as one. It starts every backend once,
+// merges their tools, resources and prompts into single lists and routes
+// each call to the server that owns it. Tools are renamed as their Backend
+// says, prompts to "<server>__<name>"; resource URIs are left unchanged and
+// must not be shared by two backends.
+// Backends that stop or cannot be reached are restarted with backoff.
+type Gateway struct {
+	// OnStatusChange, if set before Start, is called after any backend's
+	// status changes.
+	OnStatusChange func()
+
+	backends   map[string]Backend
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu       sync.RWMutex
+	ctx      context.Context
+	clients  map[string]*Client
+	catalogs map[string]*catalog
+	index    *index
+	sessions map[Conn]*session
+	status   map[string]*BackendStatus
+	failures map[string]int
+	// conflicts holds backends disabled because a tool name or resource
+	// they took on while serving collides with another backend's, and why.
+	conflicts map[string]string
+	// progress maps the progress tokens sent to backends to the session
+	// and token of the request they belong to.
+	progress     map[string]progressRoute
+	nextProgress int
+	closed       bool
+	stopped      chan struct{}
+}
+
+// progressRoute is where a backend's progress notifications go.
+type progressRoute struct {
+	session *session
+	token   json.RawMessage
+}
+
+// sessionKey is the context key for the client session a request came from.
+type sessionKey struct{}
+
+// session is a client connection and the queue of messages waiting to be
+// sent to it. Backends' messages are queued from their read loops, which
+// must not wait for a client that is slow to read.
+type session struct {
+	conn  Conn
+	queue chan *Message
+	done  chan struct{}
+}
+
+// run sends the queued messages until the session ends.
+func (s *session) run() {
+	for {
+		select {
+		case msg := <-s.queue:
+			if err := s.conn.Send(context.Background(), msg); err != nil {
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// push queues a message from a backend, dropping it if the queue is full.
+func (s *session) push(msg *Message) {
+	select {
+	case s.queue <- msg:
+	case <-s.done:
+	default:
+		log.Printf("client session is not reading, dropped %s message", describe(msg))
+	}
+}
+
+// reply queues a response; it waits for room, so responses are not lost.
+func (s *session) reply(ctx context.Context, msg *Message) {
+	select {
+	case s.queue <- msg:
+	case <-s.done:
+	case <-ctx.Done():
+	}
+}
+
+// catalog holds one backend's lists as returned by the server.
+type catalog struct {
+	tools     []map[string]interface{}
+	resources []map[string]interface{}
+	templates []map[string]interface{}
+	prompts   []map[string]interface{}
+}
+
+// route locates a tool or prompt: the backend and its name there.
+type route struct {
+	backend string
+	name    string
+}
+
+// index is the merged view of all catalogs, rebuilt whenever one changes.
+type index struct {
+	tools     []interface{}
+	resources []interface{}
+	templates []interface{}
+	prompts   []interface{}
+
+	toolRoutes     map[string]route
+	promptRoutes   map[string]route
+	resourceOwners map[string]string
+	templateOwners map[string]string // URI template prefix -> backend
+}
+
+// NewGateway returns a gateway for the given backends; call Start before
+// serving clients.
+func NewGateway(backends []Backend) *Gateway {
+	g := &Gateway{
+		backends:   map[string]Backend{},
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+		clients:    map[string]*Client{},
+		catalogs:   map[string]*catalog{},
+		sessions:   map[Conn]*session{},
+		status:     map[string]*BackendStatus{},
+		failures:   map[string]int{},
+		conflicts:  map[string]string{},
+		progress:   map[string]progressRoute{},
+		stopped:    make(chan struct{}),
+	}
+	for _, backend := range backends {
+		g.backends[backend.Name] = backend
+		g.status[backend.Name] = &BackendStatus{Name: backend.Name, State: StateStopped}
+	}
+	g.index, _ = g.buildIndex()
+	return g
+}
+
+// Start connects to and initializes every backend. Backends that fail are
+// logged and retried in the background until ctx is done or the gateway is
+// closed; Start fails if none could be started or if two of them expose a
+// tool under the same name or the same resource.
+func (g *Gateway) Start(ctx context.Context) error {
+	g.mu.Lock()
+	g.ctx = ctx
+	g.mu.Unlock()
+	names := make([]string, 0, len(g.backends))
+	for name := range g.backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var failed []string
+	for _, name := range names {
+		if err := g.connect(ctx, g.backends[name]); err != nil {
+			log.Printf("server '%s': %v", name, err)
+			g.setStatus(name, func(st *BackendStatus) { st.LastError = err.Error() })
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) == len(names) && len(names) > 0 {
+		g.Close()
+		return errors.New("no server could be started")
+	}
+
+	g.mu.Lock()
+	for _, name := range names {
+		if cat, ok := g.catalogs[name]; ok {
+			for _, tool := range unknownAliases(g.backends[name], cat) {
+				log.Printf("server '%s': tool_aliases names unknown tool '%s'", name, tool)
+			}
+		}
+	}
+	idx, collisions := g.buildIndex()
+	g.index = idx
+	g.mu.Unlock()
+	if len(collisions) > 0 {
+		g.Close()
+		report := make([]string, len(collisions))
+		for i, c := range collisions {
+			report[i] = "  " + c.String()
+		}
+		return fmt.Errorf("collisions between servers (set tool_prefix or tool_aliases to rename tools):\n%s", strings.Join(report, "\n"))
+	}
+	for _, name := range failed {
+		go g.restart(g.backends[name])
+	}
+	return nil
+}
+
+// unknownAliases lists the aliased tools a backend does not have, sorted.
+func unknownAliases(backend Backend, cat *catalog) []string {
+	have := map[string]bool{}
+	for _, tool := range cat.tools {
+		name, _ := tool["name"].(string)
+		have[name] = true
+	}
+	var unknown []string
+	for tool := range backend.ToolAliases {
+		if !have[tool] {
+			unknown = append(unknown, tool)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// Close stops restarting backends and disconnects from all of them, which
+// shuts stdio servers down, and waits until they have stopped.
+func (g *Gateway) Close() {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return
+	}
+	clients := g.clients
+	g.clients = map[string]*Client{}
+	g.closed = true
+	close(g.stopped)
+	g.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for name, client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.Close()
+			g.setStatus(name, func(st *BackendStatus) { st.State, st.PID = StateStopped, 0 })
+		}()
+	}
+	wg.Wait()
+}
+
+func (g *Gateway) connect(ctx context.Context, backend Backend) error {
+	g.setStatus(backend.Name, func(st *BackendStatus) { st.State = StateStarting })
+	conn, err := backend.Dial()
+	if err != nil {
+		return err
+	}
+	var client *Client
+	client = NewClient(conn, func(msg *Message) {
+		g.fromBackend(backend.Name, client, msg)
+	})
+
+	initCtx, cancel := context.WithTimeout(ctx, initializeTimeout)
+	defer cancel()
+	response, err := client.Call(initCtx, "initialize", map[string]interface{}{
+		"protocolVersion": protocolVersions[0],
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]interface{}{"name": "mcp-bridge", "version": implementationVersion},
+	})
+	if err == nil && response.Error != nil {
+		err = response.Error
+	}
+	if err != nil {
+		client.Close()
+		return fmt.Errorf("initialize failed: %w", err)
+	}
+	var result struct {
+		Capabilities map[string]json.RawMessage `json:"capabilities"`
+	}
+	json.Unmarshal(response.Result, &result)
+	if err := client.Send(ctx, &Message{JSONRPC: "2.0", Method: "notifications/initialized"}); err != nil {
+		client.Close()
+		return err
+	}
+
+	cat := &catalog{}
+	for kind := range result.Capabilities {
+		g.fetch(initCtx, backend.Name, client, cat, kind)
+	}
+
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		client.Close()
+		return errors.New("gateway closed")
+	}
+	g.clients[backend.Name] = client
+	g.catalogs[backend.Name] = cat
+	g.mu.Unlock()
+
+	pid := 0
+	if process, ok := conn.(interface{ PID() int }); ok {
+		pid = process.PID()
+	}
+	started := time.Now()
+	g.setStatus(backend.Name, func(st *BackendStatus) {
+		st.State, st.PID, st.LastError = StateRunning, pid, ""
+	})
+
+	go func() {
+		err := client.Err()
+		g.mu.Lock()
+		if g.closed {
+			g.mu.Unlock()
+			return
+		}
+		log.Printf("server '%s' stopped: %v", backend.Name, err)
+		if g.clients[backend.Name] == client {
+			delete(g.clients, backend.Name)
+			delete(g.catalogs, backend.Name)
+			delete(g.conflicts, backend.Name)
+			g.reindex("")
+		}
+		if time.Since(started) >= stableAfter {
+			g.failures[backend.Name] = 0
+		}
+		g.mu.Unlock()
+		client.Close()
+		g.setStatus(backend.Name, func(st *BackendStatus) { st.PID, st.LastError = 0, err.Error() })
+		g.broadcastListChanged()
+		g.restart(backend)
+	}()
+	return nil
+}
+
+func (g *Gateway) broadcastListChanged() {
+	for _, method := range []string{"notifications/tools/list_changed", "notifications/resources/list_changed", "notifications/prompts/list_changed"} {
+		g.broadcast(&Message{JSONRPC: "2.0", Method: method})
+	}
+}
+
+// fetch fills the part of cat that belongs to a server capability.
+func (g *Gateway) fetch(ctx context.Context, name string, client *Client, cat *catalog, kind string) {
+	var err error
+	switch kind {
+	case "tools":
+		cat.tools, err = listAll(ctx, client, "tools/list", "tools")
+	case "resources":
+		cat.resources, err = listAll(ctx, client, "resources/list", "resources")
+		if err == nil {
+			cat.templates, err = listAll(ctx, client, "resources/templates/list", "resourceTemplates")
+		}
+	case "prompts":
+		cat.prompts, err = listAll(ctx, client, "prompts/list", "prompts")
+	}
+	if err != nil {
+		log.Printf("server '%s': listing %s: %v", name, kind, err)
+	}
+}
+
+// listAll calls a paginated list method and returns every item.
+func listAll(ctx context.Context, client *Client, method, key string) ([]map[string]interface{}, error) {
+	var items []map[string]interface{}
+	cursor := ""
+	for {
+		var params interface{}
+		if cursor != "" {
+			params = map[string]string{"cursor": cursor}
+		}
+		response, err := client.Call(ctx, method, params)
+		if err != nil {
+			return nil, err
+		}
+		if response.Error != nil {
+			return nil, response.Error
+		}
+		var page map[string]json.RawMessage
+		if err := json.Unmarshal(response.Result, &page); err != nil {
+			return nil, err
+		}
+		var batch []map[string]interface{}
+		if raw, ok := page[key]; ok {
+			if err := json.Unmarshal(raw, &batch); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, batch...)
+		cursor = ""
+		if raw, ok := page["nextCursor"]; ok {
+			json.Unmarshal(raw, &cursor)
+		}
+		if cursor == "" {
+			return items, nil
+		}
+	}
+}
+
+// reindex rebuilds the index after changed's catalog changed while serving,
+// or after a backend went away when changed is "". Like Start, it does not
+// let one backend's tool or resource shadow another's: if changed now
+// exposes one another backend has, changed is disabled and the conflict
+// returned.
+// Callers hold g.mu.
+func (g *Gateway) reindex(changed string) string {
+	delete(g.conflicts, changed)
+	idx, collisions := g.buildIndex()
+	var report []string
+	for _, c := range collisions {
+		if c.first == changed || c.second == changed {
+			report = append(report, c.String())
+		}
+	}
+	if len(report) > 0 {
+		g.conflicts[changed] = "collision: " + strings.Join(report, "; ")
+		idx, _ = g.buildIndex()
+	}
+	g.index = idx
+	return g.conflicts[changed]
+}
+
+// reportConflict updates a backend's status after reindex: failed with the
+// conflict, or running again once its conflict is gone.
+func (g *Gateway) reportConflict(name, conflict string) {
+	if conflict != "" {
+		log.Printf("server '%s' disabled: %s (set tool_prefix or tool_aliases to rename tools)", name, conflict)
+	}
+	g.setStatus(name, func(st *BackendStatus) {
+		switch {
+		case conflict != "":
+			st.State, st.LastError = StateFailed, conflict
+		case st.State == StateFailed:
+			st.State, st.LastError = StateRunning, ""
+		}
+	})
+}
+
+// buildIndex merges the catalogs in backend name order and reports tool
+// names, resource URIs and template prefixes taken by more than one backend. Backends disabled by a conflict come
+// last and are only routed, so that calls to them get an error, not listed.
+// Callers hold g.mu.
+func (g *Gateway) buildIndex() (*index, []collision) {
+	idx := &index{
+		tools:          []interface{}{},
+		resources:      []interface{}{},
+		templates:      []interface{}{},
+		prompts:        []interface{}{},
+		toolRoutes:     map[string]route{},
+		promptRoutes:   map[string]route{},
+		resourceOwners: map[string]string{},
+		templateOwners: map[string]string{},
+	}
+
+	names := make([]string, 0, len(g.catalogs))
+	for name := range g.catalogs {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		_, iDisabled := g.conflicts[names[i]]
+		_, jDisabled := g.conflicts[names[j]]
+		if iDisabled != jDisabled {
+			return jDisabled
+		}
+		return names[i] < names[j]
+	})
+
+	var collisions []collision
+	for _, backend := range names {
+		cat := g.catalogs[backend]
+		_, disabled := g.conflicts[backend]
+		for _, tool := range cat.tools {
+			name, _ := tool["name"].(string)
+			exposed := g.backends[backend].toolName(name)
+			if existing, ok := idx.toolRoutes[exposed]; ok {
+				if !disabled {
+					collisions = append(collisions, collision{kind: "tool", name: exposed, first: existing.backend, second: backend})
+				}
+				continue
+			}
+			if !disabled {
+				idx.tools = append(idx.tools, renamed(tool, exposed))
+			}
+			idx.toolRoutes[exposed] = route{backend: backend, name: name}
+		}
+		for _, prompt := range cat.prompts {
+			name, _ := prompt["name"].(string)
+			exposed := backend + namespaceSeparator + name
+			if !disabled {
+				idx.prompts = append(idx.prompts, renamed(prompt, exposed))
+			}
+			idx.promptRoutes[exposed] = route{backend: backend, name: name}
+		}
+		for _, resource := range cat.resources {
+			uri, _ := resource["uri"].(string)
+			if existing, ok := idx.resourceOwners[uri]; ok {
+				if !disabled && existing != backend {
+					collisions = append(collisions, collision{kind: "resource", name: uri, first: existing, second: backend})
+				}
+				continue
+			}
+			if !disabled {
+				idx.resources = append(idx.resources, resource)
+			}
+			idx.resourceOwners[uri] = backend
+		}
+		for _, template := range cat.templates {
+			uriTemplate, _ := template["uriTemplate"].(string)
+			// Reads are routed by the part before the first variable.
+			prefix, _, _ := strings.Cut(uriTemplate, "{")
+			if existing, ok := idx.templateOwners[prefix]; ok {
+				if !disabled && existing != backend {
+					collisions = append(collisions, collision{kind: "resource template", name: uriTemplate, first: existing, second: backend})
+				}
+				continue
+			}
+			if !disabled {
+				idx.templates = append(idx.templates, template)
+			}
+			idx.templateOwners[prefix] = backend
+		}
+	}
+	return idx, collisions
+}
+
+func renamed(item map[string]interface{}, name string) map[string]interface{} {
+	copied := make(map[string]interface{}, len(item))
+	for k, v := range item {
+		copied[k] = v
+	}
+	copied["name"] = name
+	return copied
+}
+
+// fromBackend handles what a backend sends on its own. The gateway offers
+// backends no client capabilities, so their requests are refused.
+func (g *Gateway) fromBackend(name string, client *Client, msg *Message) {
+	if msg.IsRequest() {
+		go client.Send(context.Background(), NewError(msg.ID, CodeMethodNotFound, "mcp-bridge gateway does not support '%s'", msg.Method))
+		return
+	}
+	if !msg.IsNotification() {
+		return
+	}
+
+	kind := ""
+	switch msg.Method {
+	case "notifications/progress":
+		g.routeProgress(msg)
+		return
+	case "notifications/tools/list_changed":
+		kind = "tools"
+	case "notifications/resources/list_changed":
+		kind = "resources"
+	case "notifications/prompts/list_changed":
+		kind = "prompts"
+	default:
+		g.broadcast(msg)
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), initializeTimeout)
+		defer cancel()
+		g.mu.RLock()
+		current, ok := g.catalogs[name]
+		g.mu.RUnlock()
+		if !ok {
+			return
+		}
+		updated := *current
+		g.fetch(ctx, name, client, &updated, kind)
+		g.mu.Lock()
+		if g.clients[name] != client {
+			g.mu.Unlock()
+			return
+		}
+		g.catalogs[name] = &updated
+		conflict := g.reindex(name)
+		g.mu.Unlock()
+		g.reportConflict(name, conflict)
+		g.broadcast(&Message{JSONRPC: "2.0", Method: msg.Method})
+	}()
+}
+
+// broadcast queues msg for every client session.
+func (g *Gateway) broadcast(msg *Message) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	for _, sess := range g.sessions {
+		sess.push(msg)
+	}
+}
+
+// Serve handles one client connection until it closes or ctx is done.
+// Requests the client cancels are abandoned, at the backend too, and get
+// no response.
+func (g *Gateway) Serve(ctx context.Context, conn Conn) error {
+	sess := &session{conn: conn, queue: make(chan *Message, sessionQueueSize), done: make(chan struct{})}
+	g.mu.Lock()
+	g.sessions[conn] = sess
+	g.mu.Unlock()
+	go sess.run()
+	defer func() {
+		g.mu.Lock()
+		delete(g.sessions, conn)
+		g.mu.Unlock()
+		close(sess.done)
+	}()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var mu sync.Mutex
+	inFlight := map[string]context.CancelFunc{}
+	for {
+		msg, err := conn.Receive()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "notifications/cancelled" && msg.IsNotification() {
+			var params struct {
+				RequestID json.RawMessage `json:"requestId"`
+			}
+			json.Unmarshal(msg.Params, &params)
+			mu.Lock()
+			cancel := inFlight[idKey(params.RequestID)]
+			mu.Unlock()
+			if cancel != nil {
+				cancel()
+			}
+			continue
+		}
+		if !msg.IsRequest() {
+			continue
+		}
+		requestCtx, cancel := context.WithCancel(context.WithValue(ctx, sessionKey{}, sess))
+		key := idKey(msg.ID)
+		mu.Lock()
+		inFlight[key] = cancel
+		mu.Unlock()
+		go func() {
+			response := g.handle(requestCtx, msg)
+			mu.Lock()
+			delete(inFlight, key)
+			mu.Unlock()
+			abandoned := requestCtx.Err() != nil && ctx.Err() == nil
+			cancel()
+			if response != nil && !abandoned {
+				sess.reply(ctx, response)
+			}
+		}()
+	}
+}
+
+// ResolveTool finds the backend serving a tool listed by the gateway, for
+// use with Guard.
+func (g *Gateway) ResolveTool(name string) (server, tool string, ok bool) {
+	g.mu.RLock()
+	r, ok := g.index.toolRoutes[name]
+	g.mu.RUnlock()
+	return r.backend, r.name, ok
+}
+
+func (g *Gateway) handle(ctx context.Context, msg *Message) *Message {
+	g.mu.RLock()
+	idx := g.index
+	g.mu.RUnlock()
+
+	switch msg.Method {
+	case "initialize":
+		return g.initialize(msg)
+	case "ping":
+		return result(msg, map[string]interface{}{})
+	case "tools/list":
+		return result(msg, map[string]interface{}{"tools": idx.tools})
+	case "resources/list":
+		return result(msg, map[string]interface{}{"resources": idx.resources})
+	case "resources/templates/list":
+		return result(msg, map[string]interface{}{"resourceTemplates": idx.templates})
+	case "prompts/list":
+		return result(msg, map[string]interface{}{"prompts": idx.prompts})
+	case "tools/call":
+		return g.forwardNamed(ctx, msg, idx.toolRoutes, "tool")
+	case "prompts/get":
+		return g.forwardNamed(ctx, msg, idx.promptRoutes, "prompt")
+	case "resources/read", "resources/subscribe", "resources/unsubscribe":
+		var params struct {
+			URI string `json:"uri"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		backend, ok := idx.resourceOwner(params.URI)
+		if !ok {
+			return NewError(msg.ID, CodeInvalidParams, "unknown resource '%s'", params.URI)
+		}
+		return g.forward(ctx, backend, msg, msg.Params)
+	case "completion/complete":
+		return g.complete(ctx, msg, idx)
+	case "logging/setLevel":
+		g.mu.RLock()
+		clients := make([]*Client, 0, len(g.clients))
+		for _, client := range g.clients {
+			clients = append(clients, client)
+		}
+		g.mu.RUnlock()
+		for _, client := range clients {
+			client.Forward(ctx, msg)
+		}
+		return result(msg, map[string]interface{}{})
+	default:
+		return NewError(msg.ID, CodeMethodNotFound, "method '%s' not found", msg.Method)
+	}
+}
+
+func (g *Gateway) initialize(msg *Message) *Message {
+	var params struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	json.Unmarshal(msg.Params, &params)
+	version := protocolVersions[0]
+	for _, supported := range protocolVersions {
+		if params.ProtocolVersion == supported {
+			version = supported
+		}
+	}
+	return result(msg, map[string]interface{}{
+		"protocolVersion": version,
+		"capabilities": map[string]interface{}{
+			"tools":     map[string]interface{}{"listChanged": true},
+			"resources": map[string]interface{}{"listChanged": true, "subscribe": true},
+			"prompts":   map[string]interface{}{"listChanged": true},
+			"logging":   map[string]interface{}{},
+		},
+		"serverInfo": map[string]interface{}{"name": "mcp-bridge", "version": implementationVersion},
+	})
+}
+
+// forwardNamed routes a tools/call or prompts/get by its "name" param,
+// renaming it to the backend's own name.
+func (g *Gateway) forwardNamed(ctx context.Context, msg *Message, routes map[string]route, kind string) *Message {
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return NewError(msg.ID, CodeInvalidParams, "invalid params: %v", err)
+	}
+	var name string
+	json.Unmarshal(params["name"], &name)
+	r, ok := routes[name]
+	if !ok {
+		return NewError(msg.ID, CodeInvalidParams, "unknown %s '%s'", kind, name)
+	}
+	params["name"], _ = json.Marshal(r.name)
+	raw, _ := json.Marshal(params)
+	return g.forward(ctx, r.backend, msg, raw)
+}
+
+// complete routes completion/complete by the prompt or resource it refers to.
+func (g *Gateway) complete(ctx context.Context, msg *Message, idx *index) *Message {
+	var params map[string]json.RawMessage
+	var ref map[string]interface{}
+	if json.Unmarshal(msg.Params, &params) != nil || json.Unmarshal(params["ref"], &ref) != nil {
+		return NewError(msg.ID, CodeInvalidParams, "invalid params")
+	}
+	switch ref["type"] {
+	case "ref/prompt":
+		name, _ := ref["name"].(string)
+		r, ok := idx.promptRoutes[name]
+		if !ok {
+			return NewError(msg.ID, CodeInvalidParams, "unknown prompt '%s'", name)
+		}
+		ref["name"] = r.name
+		params["ref"], _ = json.Marshal(ref)
+		raw, _ := json.Marshal(params)
+		return g.forward(ctx, r.backend, msg, raw)
+	case "ref/resource":
+		uri, _ := ref["uri"].(string)
+		backend, ok := idx.resourceOwner(uri)
+		if !ok {
+			return NewError(msg.ID, CodeInvalidParams, "unknown resource '%s'", uri)
+		}
+		return g.forward(ctx, backend, msg, msg.Params)
+	default:
+		return NewError(msg.ID, CodeInvalidParams, "unsupported ref type '%v'", ref["type"])
+	}
+}
+
+// resourceOwner finds the backend serving uri: one that listed it, or the
+// one whose URI template has the longest matching literal prefix.
+func (idx *index) resourceOwner(uri string) (string, bool) {
+	if backend, ok := idx.resourceOwners[uri]; ok {
+		return backend, true
+	}
+	best, owner := "", ""
+	for prefix, backend := range idx.templateOwners {
+		if prefix != "" && strings.HasPrefix(uri, prefix) && len(prefix) > len(best) {
+			best, owner = prefix, backend
+		}
+	}
+	return owner, owner != ""
+}
+
+func (g *Gateway) forward(ctx context.Context, backend string, msg *Message, params json.RawMessage) *Message {
+	g.mu.RLock()
+	client := g.clients[backend]
+	conflict := g.conflicts[backend]
+	g.mu.RUnlock()
+	if client == nil {
+		return NewError(msg.ID, CodeInternalError, "server '%s' is not running", backend)
+	}
+	if conflict != "" {
+		return NewError(msg.ID, CodeInternalError, "server '%s' is disabled: %s", backend, conflict)
+	}
+	request := *msg
+	request.Params = params
+	if sess, ok := ctx.Value(sessionKey{}).(*session); ok {
+		if token, rewritten := g.trackProgress(sess, params); token != "" {
+			request.Params = rewritten
+			defer func() {
+				g.mu.Lock()
+				delete(g.progress, token)
+				g.mu.Unlock()
+			}()
+		}
+	}
+	response, err := client.Forward(ctx, &request)
+	if err != nil {
+		return NewError(msg.ID, CodeInternalError, "server '%s': %v", backend, err)
+	}
+	return response
+}
+
+// trackProgress replaces the progress token in a request's params with one
+// unique to the gateway, as tokens from different sessions may clash, and
+// remembers where its notifications go. It returns "" if there is none.
+func (g *Gateway) trackProgress(sess *session, params json.RawMessage) (string, json.RawMessage) {
+	var fields, meta map[string]json.RawMessage
+	if json.Unmarshal(params, &fields) != nil || json.Unmarshal(fields["_meta"], &meta) != nil || meta["progressToken"] == nil {
+		return "", params
+	}
+	g.mu.Lock()
+	g.nextProgress++
+	token := fmt.Sprintf("mcp-bridge-progress-%d", g.nextProgress)
+	g.progress[token] = progressRoute{session: sess, token: meta["progressToken"]}
+	g.mu.Unlock()
+	meta["progressToken"], _ = json.Marshal(token)
+	fields["_meta"], _ = json.Marshal(meta)
+	raw, _ := json.Marshal(fields)
+	return token, raw
+}
+
+// routeProgress sends a backend's progress notification to the session
+// whose request it is about, with that session's token restored.
+func (g *Gateway) routeProgress(msg *Message) {
+	var params map[string]json.RawMessage
+	var token string
+	json.Unmarshal(msg.Params, &params)
+	json.Unmarshal(params["progressToken"], &token)
+	g.mu.RLock()
+	r, ok := g.progress[token]
+	g.mu.RUnlock()
+	if !ok {
+		return
+	}
+	params["progressToken"] = r.token
+	notification := *msg
+	notification.Params, _ = json.Marshal(params)
+	r.session.push(&notification)
+}
+
+func result(msg *Message, value interface{}) *Message {
+	response, err := NewResult(msg.ID, value)
+	if err != nil {
+		return NewError(msg.ID, CodeInternalError, "%v", err)
+	}
+	return response
+}
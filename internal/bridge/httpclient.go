@@ -0,0 +1,396 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sessionHeader  = "Mcp-Session-Id"
+	protocolHeader = "Mcp-Protocol-Version"
+)
+
+// HTTPConn is a client connection to a streamable HTTP MCP endpoint. Every
+// sent message is POSTed; responses arrive as a JSON body or on an SSE
+// stream and are queued for Receive. Once the server assigns a session, a
+// GET stream carries the messages the server sends on its own.
+type HTTPConn struct {
+	url      string
+	headers  map[string]string
+	client   *http.Client
+	incoming chan *Message
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	mu              sync.Mutex
+	sessionID       string
+	protocolVersion string
+	listening       bool
+	closeOnce       sync.Once
+}
+
+// DialHTTP returns a connection to the streamable HTTP endpoint at rawURL,
+// sending headers with every request. No request is made until the first
+// Send.
+func DialHTTP(rawURL string, headers map[string]string) *HTTPConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &HTTPConn{
+		url:      rawURL,
+		headers:  headers,
+		client:   &http.Client{},
+		incoming: make(chan *Message, 64),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Send posts msg. Requests other than initialize are posted in the
+// background so that a slow call does not hold up the messages after it;
+// a failed request is answered with a JSON-RPC error.
+func (c *HTTPConn) Send(ctx context.Context, msg *Message) error {
+	if !msg.IsRequest() || msg.Method == "initialize" {
+		return c.post(msg)
+	}
+	go func() {
+		if err := c.post(msg); err != nil {
+			c.deliver(NewError(msg.ID, CodeInternalError, "%s: %v", c.url, err))
+		}
+	}()
+	return nil
+}
+
+func (c *HTTPConn) Receive() (*Message, error) {
+	select {
+	case msg := <-c.incoming:
+		return msg, nil
+	case <-c.ctx.Done():
+		return nil, io.EOF
+	}
+}
+
+// Close ends the session, if the server assigned one, and stops all
+// streams.
+func (c *HTTPConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		sessionID := c.sessionID
+		c.mu.Unlock()
+		if sessionID != "" {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if req, err := c.newRequest(ctx, http.MethodDelete, nil); err == nil {
+				if resp, err := c.client.Do(req); err == nil {
+					resp.Body.Close()
+				}
+			}
+		}
+		c.cancel()
+	})
+	return nil
+}
+
+func (c *HTTPConn) newRequest(ctx context.Context, method string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
+	}
+	c.mu.Lock()
+	if c.sessionID != "" {
+		req.Header.Set(sessionHeader, c.sessionID)
+	}
+	if c.protocolVersion != "" {
+		req.Header.Set(protocolHeader, c.protocolVersion)
+	}
+	c.mu.Unlock()
+	return req, nil
+}
+
+func (c *HTTPConn) post(msg *Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequest(c.ctx, http.MethodPost, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if sessionID := resp.Header.Get(sessionHeader); sessionID != "" {
+		c.mu.Lock()
+		c.sessionID = sessionID
+		c.mu.Unlock()
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusAccepted || resp.StatusCode == http.StatusNoContent:
+		return nil
+	case resp.StatusCode == http.StatusNotFound && req.Header.Get(sessionHeader) != "":
+		return fmt.Errorf("session expired (HTTP 404)")
+	case resp.StatusCode/100 != 2:
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(snippet)))
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/event-stream":
+		err = readSSE(resp.Body, func(event, data string) error {
+			return c.receiveData(msg, []byte(data))
+		})
+	case "application/json":
+		data, readErr := io.ReadAll(resp.Body)
+		if readErr != nil {
+			return readErr
+		}
+		err = c.receiveData(msg, data)
+	default:
+		err = fmt.Errorf("unexpected Content-Type '%s'", resp.Header.Get("Content-Type"))
+	}
+	if err != nil {
+		return err
+	}
+
+	if msg.Method == "initialize" {
+		c.listen()
+	}
+	return nil
+}
+
+// receiveData queues a JSON-RPC message, or a batch of them, received in
+// reply to sent, noting the negotiated protocol version.
+func (c *HTTPConn) receiveData(sent *Message, data []byte) error {
+	data = bytes.TrimSpace(data)
+	var messages []*Message
+	if len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("invalid JSON-RPC batch: %w", err)
+		}
+	} else {
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return fmt.Errorf("invalid JSON-RPC message: %w", err)
+		}
+		messages = append(messages, &msg)
+	}
+
+	for _, msg := range messages {
+		if sent.Method == "initialize" && msg.IsResponse() && idKey(msg.ID) == idKey(sent.ID) && msg.Result != nil {
+			var result struct {
+				ProtocolVersion string `json:"protocolVersion"`
+			}
+			if json.Unmarshal(msg.Result, &result) == nil {
+				c.mu.Lock()
+				c.protocolVersion = result.ProtocolVersion
+				c.mu.Unlock()
+			}
+		}
+		c.deliver(msg)
+	}
+	return nil
+}
+
+func (c *HTTPConn) deliver(msg *Message) {
+	select {
+	case c.incoming <- msg:
+	case <-c.ctx.Done():
+	}
+}
+
+// listen opens the GET stream for server-initiated messages, reopening it
+// when the server ends it. Servers without one answer 405, which stops it.
+func (c *HTTPConn) listen() {
+	c.mu.Lock()
+	if c.listening {
+		c.mu.Unlock()
+		return
+	}
+	c.listening = true
+	c.mu.Unlock()
+
+	go func() {
+		for c.ctx.Err() == nil {
+			req, err := c.newRequest(c.ctx, http.MethodGet, nil)
+			if err != nil {
+				return
+			}
+			req.Header.Set("Accept", "text/event-stream")
+			resp, err := c.client.Do(req)
+			if err != nil {
+				return
+			}
+			if resp.StatusCode != http.StatusOK {
+				resp.Body.Close()
+				return
+			}
+			err = readSSE(resp.Body, func(event, data string) error {
+				var msg Message
+				if err := json.Unmarshal([]byte(data), &msg); err != nil {
+					return err
+				}
+				c.deliver(&msg)
+				return nil
+			})
+			resp.Body.Close()
+			if err != nil && c.ctx.Err() == nil {
+				log.Printf("%s: event stream: %v", c.url, err)
+			}
+			select {
+			case <-time.After(time.Second):
+			case <-c.ctx.Done():
+			}
+		}
+	}()
+}
+
+// SSEConn is a client connection to a legacy HTTP+SSE MCP endpoint: the
+// server streams messages over a GET request whose first "endpoint" event
+// names the URL that messages are POSTed to.
+type SSEConn struct {
+	headers  map[string]string
+	client   *http.Client
+	endpoint string
+	incoming chan *Message
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// sseHandshakeTimeout bounds the wait for the "endpoint" event.
+const sseHandshakeTimeout = 30 * time.Second
+
+// DialSSE opens the event stream at rawURL and waits for the server to
+// announce its message endpoint.
+func DialSSE(rawURL string, headers map[string]string) (*SSEConn, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &SSEConn{
+		headers:  headers,
+		client:   &http.Client{},
+		incoming: make(chan *Message, 64),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("%s: HTTP %d", rawURL, resp.StatusCode)
+	}
+
+	endpoints := make(chan string, 1)
+	go func() {
+		defer resp.Body.Close()
+		defer cancel()
+		err := readSSE(resp.Body, func(event, data string) error {
+			switch event {
+			case "endpoint":
+				ref, err := url.Parse(strings.TrimSpace(data))
+				if err != nil {
+					return fmt.Errorf("invalid endpoint '%s': %w", data, err)
+				}
+				select {
+				case endpoints <- base.ResolveReference(ref).String():
+				default:
+				}
+			case "message":
+				var msg Message
+				if err := json.Unmarshal([]byte(data), &msg); err != nil {
+					return fmt.Errorf("invalid JSON-RPC message: %w", err)
+				}
+				select {
+				case c.incoming <- &msg:
+				case <-ctx.Done():
+				}
+			}
+			return nil
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Printf("%s: event stream: %v", rawURL, err)
+		}
+	}()
+
+	select {
+	case c.endpoint = <-endpoints:
+		return c, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s: event stream closed before the endpoint event", rawURL)
+	case <-time.After(sseHandshakeTimeout):
+		cancel()
+		return nil, fmt.Errorf("%s: no endpoint event after %s", rawURL, sseHandshakeTimeout)
+	}
+}
+
+func (c *SSEConn) Send(ctx context.Context, msg *Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: HTTP %d", c.endpoint, resp.StatusCode)
+	}
+	return nil
+}
+
+func (c *SSEConn) Receive() (*Message, error) {
+	select {
+	case msg := <-c.incoming:
+		return msg, nil
+	case <-c.ctx.Done():
+		return nil, io.EOF
+	}
+}
+
+func (c *SSEConn) Close() error {
+	c.cancel()
+	return nil
+}
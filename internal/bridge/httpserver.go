@@ -0,0 +1,431 @@
+package bridge
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultIdleTimeout is how long a session may go without requests or an
+// open event stream before it is closed.
+const defaultIdleTimeout = 30 * time.Minute
+
+// HTTPServer exposes MCP on a streamable HTTP endpoint. Every client that
+// initializes gets its own session, a Conn passed to the serve function in
+// a new goroutine; the session ends when serve returns or the client
+// deletes it or leaves it idle. Responses are returned as the POST body and
+// all other messages from serve are streamed to the client's GET request;
+// requests for the client fail while it has no stream open.
+type HTTPServer struct {
+	// IdleTimeout ends sessions that have had no request and no event
+	// stream for that long. NewHTTPServer sets it to 30 minutes; zero keeps
+	// sessions until they are deleted.
+	IdleTimeout time.Duration
+
+	serve func(conn Conn)
+
+	mu       sync.Mutex
+	sessions map[string]*httpSession
+	running  sync.WaitGroup
+}
+
+// NewHTTPServer returns a server that runs serve for each session.
+func NewHTTPServer(serve func(conn Conn)) *HTTPServer {
+	return &HTTPServer{IdleTimeout: defaultIdleTimeout, serve: serve, sessions: map[string]*httpSession{}}
+}
+
+// Close ends every session and waits for their serve functions to return.
+func (s *HTTPServer) Close() {
+	s.mu.Lock()
+	sessions := s.sessions
+	s.sessions = map[string]*httpSession{}
+	s.mu.Unlock()
+	for _, sess := range sessions {
+		sess.Close()
+	}
+	s.running.Wait()
+}
+
+func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Reject cross-origin browser requests to guard against DNS rebinding.
+	if origin := r.Header.Get("Origin"); origin != "" && !isLocalOrigin(origin) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		s.handlePost(w, r)
+	case http.MethodGet:
+		sess := s.session(w, r)
+		if sess != nil {
+			defer sess.busy()()
+			sess.stream(w, r)
+		}
+	case http.MethodDelete:
+		sess := s.session(w, r)
+		if sess != nil {
+			s.remove(sess)
+			sess.Close()
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *HTTPServer) handlePost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxLineSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var msg Message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		writeJSON(w, http.StatusBadRequest, NewError(nil, CodeParseError, "invalid JSON-RPC message: %v", err))
+		return
+	}
+
+	var sess *httpSession
+	if msg.Method == "initialize" && r.Header.Get(sessionHeader) == "" {
+		sess = s.newSession()
+		w.Header().Set(sessionHeader, sess.id)
+	} else if sess = s.session(w, r); sess == nil {
+		return
+	}
+	defer sess.busy()()
+
+	if !msg.IsRequest() {
+		if err := sess.push(r, &msg); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	response, err := sess.call(r, &msg)
+	if err != nil {
+		writeJSON(w, http.StatusOK, NewError(msg.ID, CodeInternalError, "%v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// session returns the session named by the request's session header,
+// writing an error response if there is none.
+func (s *HTTPServer) session(w http.ResponseWriter, r *http.Request) *httpSession {
+	id := r.Header.Get(sessionHeader)
+	if id == "" {
+		http.Error(w, "missing "+sessionHeader+" header", http.StatusBadRequest)
+		return nil
+	}
+	s.mu.Lock()
+	sess := s.sessions[id]
+	s.mu.Unlock()
+	if sess == nil {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return nil
+	}
+	return sess
+}
+
+func (s *HTTPServer) newSession() *httpSession {
+	sess := &httpSession{
+		id:       newSessionID(),
+		inbound:  make(chan *Message),
+		outbound: make(chan *Message, 64),
+		waiting:  map[string]chan *Message{},
+		done:     make(chan struct{}),
+	}
+	if s.IdleTimeout > 0 {
+		sess.idleTimeout = s.IdleTimeout
+		sess.idle = time.AfterFunc(s.IdleTimeout, func() { s.expire(sess) })
+	}
+	s.mu.Lock()
+	s.sessions[sess.id] = sess
+	s.mu.Unlock()
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		s.serve(sess)
+		s.remove(sess)
+		sess.Close()
+	}()
+	return sess
+}
+
+// expire closes a session whose idle timer fired, unless it has been used
+// since.
+func (s *HTTPServer) expire(sess *httpSession) {
+	sess.mu.Lock()
+	idle := sess.active == 0 && time.Since(sess.lastActive) >= sess.idleTimeout
+	sess.mu.Unlock()
+	if !idle {
+		return
+	}
+	log.Printf("session %s: idle for %s, closing it", sess.id, sess.idleTimeout)
+	s.remove(sess)
+	sess.Close()
+}
+
+func (s *HTTPServer) remove(sess *httpSession) {
+	s.mu.Lock()
+	if s.sessions[sess.id] == sess {
+		delete(s.sessions, sess.id)
+	}
+	s.mu.Unlock()
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func isLocalOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func writeJSON(w http.ResponseWriter, status int, msg *Message) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(msg)
+}
+
+// httpSession is the server side of one client session: Receive yields
+// the client's messages and Send routes responses to the waiting POST and
+// everything else to the client's GET stream.
+type httpSession struct {
+	id       string
+	inbound  chan *Message
+	outbound chan *Message
+
+	mu      sync.Mutex
+	waiting map[string]chan *Message
+	// active counts the session's requests in progress, including event
+	// streams, of which there are streams.
+	active     int
+	streams    int
+	lastActive time.Time
+
+	idleTimeout time.Duration
+	idle        *time.Timer
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+var errSessionClosed = errors.New("session closed")
+
+func (sess *httpSession) Send(ctx context.Context, msg *Message) error {
+	if msg.IsResponse() {
+		sess.mu.Lock()
+		ch, ok := sess.waiting[idKey(msg.ID)]
+		delete(sess.waiting, idKey(msg.ID))
+		sess.mu.Unlock()
+		if ok {
+			ch <- msg
+			return nil
+		}
+	}
+	// Notifications wait for a stream to be opened, requests are only sent
+	// on one that is open.
+	sess.mu.Lock()
+	streaming := sess.streams > 0
+	sess.mu.Unlock()
+	if msg.IsRequest() && !streaming {
+		sess.drop(msg, "no event stream")
+		return nil
+	}
+	select {
+	case sess.outbound <- msg:
+	case <-sess.done:
+		return errSessionClosed
+	default:
+		reason := "no event stream"
+		if streaming {
+			reason = "event stream is full"
+		}
+		sess.drop(msg, reason)
+	}
+	return nil
+}
+
+// drop logs a message that cannot be sent to the client. A request is
+// answered with an error in the client's place, so that its sender does
+// not wait for ever.
+func (sess *httpSession) drop(msg *Message, reason string) {
+	log.Printf("session %s: %s, dropped %s message", sess.id, reason, describe(msg))
+	if !msg.IsRequest() {
+		return
+	}
+	response := NewError(msg.ID, CodeInternalError, "request '%s' could not be sent to the client: %s", msg.Method, reason)
+	go func() {
+		select {
+		case sess.inbound <- response:
+		case <-sess.done:
+		}
+	}()
+}
+
+func (sess *httpSession) Receive() (*Message, error) {
+	select {
+	case msg := <-sess.inbound:
+		return msg, nil
+	case <-sess.done:
+		return nil, io.EOF
+	}
+}
+
+func (sess *httpSession) Close() error {
+	sess.closeOnce.Do(func() {
+		close(sess.done)
+		if sess.idle != nil {
+			sess.idle.Stop()
+		}
+	})
+	return nil
+}
+
+// busy marks the start of an HTTP request on the session and returns the
+// function that marks its end, which restarts the idle timer once no
+// request is left.
+func (sess *httpSession) busy() func() {
+	sess.mu.Lock()
+	sess.active++
+	if sess.idle != nil {
+		sess.idle.Stop()
+	}
+	sess.mu.Unlock()
+	return func() {
+		sess.mu.Lock()
+		sess.active--
+		sess.lastActive = time.Now()
+		if sess.active == 0 && sess.idle != nil {
+			sess.idle.Reset(sess.idleTimeout)
+		}
+		sess.mu.Unlock()
+	}
+}
+
+func (sess *httpSession) push(r *http.Request, msg *Message) error {
+	select {
+	case sess.inbound <- msg:
+		return nil
+	case <-sess.done:
+		return errSessionClosed
+	case <-r.Context().Done():
+		return r.Context().Err()
+	}
+}
+
+// call passes a request to the session and waits for its response.
+func (sess *httpSession) call(r *http.Request, msg *Message) (*Message, error) {
+	key := idKey(msg.ID)
+	ch := make(chan *Message, 1)
+	sess.mu.Lock()
+	if _, busy := sess.waiting[key]; busy {
+		sess.mu.Unlock()
+		return nil, errors.New("a request with this id is already in progress")
+	}
+	sess.waiting[key] = ch
+	sess.mu.Unlock()
+
+	release := func() {
+		sess.mu.Lock()
+		if sess.waiting[key] == ch {
+			delete(sess.waiting, key)
+		}
+		sess.mu.Unlock()
+	}
+
+	if err := sess.push(r, msg); err != nil {
+		release()
+		return nil, err
+	}
+	select {
+	case response := <-ch:
+		return response, nil
+	case <-sess.done:
+		release()
+		return nil, errSessionClosed
+	case <-r.Context().Done():
+		release()
+		return nil, r.Context().Err()
+	}
+}
+
+// stream sends the session's other messages to the client as SSE.
+func (sess *httpSession) stream(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		http.Error(w, "GET requires Accept: text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	sess.mu.Lock()
+	sess.streams++
+	sess.mu.Unlock()
+	defer func() {
+		sess.mu.Lock()
+		sess.streams--
+		sess.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case msg := <-sess.outbound:
+			data, err := json.Marshal(msg)
+			if err != nil {
+				continue
+			}
+			if err := writeSSE(w, "message", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-sess.done:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// describe names a message for logs.
+func describe(msg *Message) string {
+	if msg.Method != "" {
+		return msg.Method
+	}
+	return "response " + string(msg.ID)
+}
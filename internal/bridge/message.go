@@ -0,0 +1,91 @@
+// Package bridge moves MCP JSON-RPC messages between transports: stdio
+// processes, streamable HTTP endpoints and legacy SSE endpoints.
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// JSON-RPC error codes used by the bridge.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Message is a JSON-RPC 2.0 request, notification or response. Params and
+// Result are kept as raw JSON so that messages pass through unchanged.
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is the error member of a JSON-RPC response.
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
+// IsRequest reports whether m expects a response.
+func (m *Message) IsRequest() bool {
+	return m.Method != "" && len(m.ID) > 0
+}
+
+// IsNotification reports whether m is a request without an ID.
+func (m *Message) IsNotification() bool {
+	return m.Method != "" && len(m.ID) == 0
+}
+
+// IsResponse reports whether m answers a request.
+func (m *Message) IsResponse() bool {
+	return m.Method == "" && len(m.ID) > 0
+}
+
+// idKey identifies a request ID for matching responses; 1 and "1" differ.
+func idKey(id json.RawMessage) string {
+	return string(id)
+}
+
+// NewRequest builds a request with the given ID, encoding params as JSON.
+func NewRequest(id interface{}, method string, params interface{}) (*Message, error) {
+	rawID, err := json.Marshal(id)
+	if err != nil {
+		return nil, err
+	}
+	msg := &Message{JSONRPC: "2.0", ID: rawID, Method: method}
+	if params != nil {
+		if msg.Params, err = json.Marshal(params); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+// NewResult builds a successful response to the request with the given ID.
+func NewResult(id json.RawMessage, result interface{}) (*Message, error) {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{JSONRPC: "2.0", ID: id, Result: raw}, nil
+}
+
+// NewError builds an error response to the request with the given ID.
+func NewError(id json.RawMessage, code int, format string, args ...interface{}) *Message {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return &Message{JSONRPC: "2.0", ID: id, Error: &Error{Code: code, Message: fmt.Sprintf(format, args...)}}
+}
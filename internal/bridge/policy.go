@@ -0,0 +1,141 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/thewoolleyman/mcp-adapter-example/internal/mcp"
+)
+
+// CodePolicyDenied is the JSON-RPC error returned for tool calls the
+// policy blocks.
+const CodePolicyDenied = -32001
+
+// ToolResolver maps a tool name as a client sees it to the canonical server
+// and the server's own name for the tool. ok is false for unknown tools.
+type ToolResolver func(name string) (server, tool string, ok bool)
+
+// SingleServer resolves every tool to one server under its own name.
+func SingleServer(server string) ToolResolver {
+	return func(name string) (string, string, bool) { return server, name, true }
+}
+
+// Guard enforces policy on the tools/call requests a client sends over
+// conn. Denied calls are answered with an error. Calls that need
+// confirmation are held while the client is asked through MCP elicitation,
+// and refused if the client cannot be asked.
+func Guard(conn Conn, policy *mcp.Policy, resolve ToolResolver) Conn {
+	if policy == nil {
+		return conn
+	}
+	return &guardConn{Conn: conn, policy: policy, resolve: resolve, held: map[string]*Message{}}
+}
+
+type guardConn struct {
+	Conn
+	policy  *mcp.Policy
+	resolve ToolResolver
+
+	// Receive runs on a single goroutine, so these need no lock.
+	elicitation bool
+	nextID      int
+	held        map[string]*Message
+}
+
+func (c *guardConn) Receive() (*Message, error) {
+	for {
+		msg, err := c.Conn.Receive()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case msg.IsRequest() && msg.Method == "initialize":
+			var params struct {
+				Capabilities map[string]json.RawMessage `json:"capabilities"`
+			}
+			json.Unmarshal(msg.Params, &params)
+			_, c.elicitation = params.Capabilities["elicitation"]
+		case msg.IsResponse():
+			if call, ok := c.held[idKey(msg.ID)]; ok {
+				delete(c.held, idKey(msg.ID))
+				if confirmed(msg) {
+					return call, nil
+				}
+				c.refuse(call, "the call was not confirmed")
+				continue
+			}
+		case msg.IsRequest() && msg.Method == "tools/call":
+			if c.gate(msg) {
+				continue
+			}
+		}
+		return msg, nil
+	}
+}
+
+// gate checks a tools/call against the policy and reports whether it was
+// answered or held instead of being passed on.
+func (c *guardConn) gate(msg *Message) bool {
+	var params struct {
+		Name      string                 `json:"name"`
+		Arguments map[string]interface{} `json:"arguments"`
+	}
+	json.Unmarshal(msg.Params, &params)
+	server, tool, ok := c.resolve(params.Name)
+	if !ok {
+		return false
+	}
+
+	decision := c.policy.Check(server, tool, params.Arguments)
+	description := fmt.Sprintf("tool '%s'", tool)
+	if server != "" {
+		description += fmt.Sprintf(" on server '%s'", server)
+	}
+	switch decision.Action {
+	case mcp.ActionDeny:
+		c.refuse(msg, withReason(description+" is denied by policy", decision.Reason))
+		return true
+	case mcp.ActionConfirm:
+		if !c.elicitation {
+			c.refuse(msg, withReason(description+" needs confirmation, which this client cannot give", decision.Reason))
+			return true
+		}
+		c.nextID++
+		id := fmt.Sprintf("mcp-bridge-policy-%d", c.nextID)
+		ask, err := NewRequest(id, "elicitation/create", map[string]interface{}{
+			"message":         withReason("Allow "+description+"?", decision.Reason),
+			"requestedSchema": map[string]interface{}{"type": "object", "properties": map[string]interface{}{}},
+		})
+		if err == nil {
+			err = c.Conn.Send(context.Background(), ask)
+		}
+		if err != nil {
+			c.refuse(msg, fmt.Sprintf("could not ask to confirm %s: %v", description, err))
+			return true
+		}
+		c.held[idKey(ask.ID)] = msg
+		return true
+	}
+	return false
+}
+
+func (c *guardConn) refuse(msg *Message, reason string) {
+	c.Conn.Send(context.Background(), NewError(msg.ID, CodePolicyDenied, "%s", reason))
+}
+
+// confirmed reports whether an elicitation response accepts the request.
+func confirmed(response *Message) bool {
+	var result struct {
+		Action string `json:"action"`
+	}
+	return response.Error == nil && json.Unmarshal(response.Result, &result) == nil && result.Action == "accept"
+}
+
+func withReason(message, reason string) string {
+	if reason == "" {
+		return message
+	}
+	return message + ": " + reason
+}
@@ -0,0 +1,128 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// Command describes a stdio server process.
+type Command struct {
+	Path string
+	Args []string
+	Env  map[string]string
+	Dir  string
+	// Stderr receives the process's stderr; nil means os.Stderr.
+	Stderr io.Writer
+}
+
+// Process is a running stdio server. Its Conn is connected to the
+// process's stdin and stdout.
+type Process struct {
+	*StdioConn
+	cmd  *exec.Cmd
+	done chan struct{}
+	err  error
+}
+
+// shutdownGrace is how long a stdio server has to exit after its stdin is
+// closed before it is killed.
+const shutdownGrace = 5 * time.Second
+
+// Start launches the command with its environment layered over the
+// bridge's own.
+func Start(command Command) (*Process, error) {
+	cmd := exec.Command(command.Path, command.Args...)
+	cmd.Dir = command.Dir
+	cmd.Env = os.Environ()
+	keys := make([]string, 0, len(command.Env))
+	for key := range command.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		cmd.Env = append(cmd.Env, key+"="+command.Env[key])
+	}
+	cmd.Stderr = command.Stderr
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", command.Path, err)
+	}
+
+	p := &Process{cmd: cmd, done: make(chan struct{})}
+	p.StdioConn = NewStdioConn(stdout, stdin, nil)
+	go func() {
+		p.err = cmd.Wait()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// Done is closed when the process has exited.
+func (p *Process) Done() <-chan struct{} {
+	return p.done
+}
+
+// PID returns the operating system's process ID.
+func (p *Process) PID() int {
+	return p.cmd.Process.Pid
+}
+
+// Err returns the process's exit error once Done is closed.
+func (p *Process) Err() error {
+	return p.err
+}
+
+// Close shuts the process down the way MCP's stdio transport prescribes:
+// close its stdin, then terminate it if it does not exit in time.
+func (p *Process) Close() error {
+	return p.Stop(context.Background())
+}
+
+// Stop closes the process's stdin and waits for it to exit. A process
+// still running after shutdownGrace, or once ctx is done, is sent SIGTERM
+// and then killed.
+func (p *Process) Stop(ctx context.Context) error {
+	if closer, ok := p.StdioConn.w.(io.Closer); ok {
+		closer.Close()
+	}
+	if p.wait(ctx, shutdownGrace) {
+		return nil
+	}
+	p.cmd.Process.Signal(syscall.SIGTERM)
+	if p.wait(context.Background(), shutdownGrace/2) {
+		return nil
+	}
+	p.cmd.Process.Kill()
+	<-p.done
+	return nil
+}
+
+// wait reports whether the process exited within timeout.
+func (p *Process) wait(ctx context.Context, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-p.done:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return false
+}
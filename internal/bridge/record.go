@@ -0,0 +1,210 @@
+package bridge
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Directions of recorded messages.
+const (
+	ClientToServer = "client_to_server"
+	ServerToClient = "server_to_client"
+)
+
+// RecordedMessage is one line of a session recording.
+type RecordedMessage struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Message   *Message  `json:"message"`
+}
+
+// Recorder writes every message passing through the Conns it wraps to w as
+// JSON lines.
+type Recorder struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// Wrap records the messages received from conn as travelling in direction.
+func (r *Recorder) Wrap(conn Conn, direction string) Conn {
+	return &recordingConn{Conn: conn, recorder: r, direction: direction}
+}
+
+func (r *Recorder) record(direction string, msg *Message) error {
+	data, err := json.Marshal(RecordedMessage{Time: time.Now().UTC(), Direction: direction, Message: msg})
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err = r.w.Write(append(data, '\n'))
+	return err
+}
+
+type recordingConn struct {
+	Conn
+	recorder  *Recorder
+	direction string
+}
+
+func (c *recordingConn) Receive() (*Message, error) {
+	msg, err := c.Conn.Receive()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.recorder.record(c.direction, msg); err != nil {
+		return nil, fmt.Errorf("recording message: %w", err)
+	}
+	return msg, nil
+}
+
+// LoadRecording reads a session written by a Recorder.
+func LoadRecording(path string) ([]RecordedMessage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var recording []RecordedMessage
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry RecordedMessage
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Message == nil {
+			return nil, fmt.Errorf("%s:%d: not a recorded message", path, line)
+		}
+		if entry.Direction != ClientToServer && entry.Direction != ServerToClient {
+			return nil, fmt.Errorf("%s:%d: unknown direction '%s'", path, line, entry.Direction)
+		}
+		recording = append(recording, entry)
+	}
+	return recording, scanner.Err()
+}
+
+// exchange is a recorded request with the server's answer to it.
+type exchange struct {
+	request       *Message
+	notifications []*Message
+	response      *Message
+	used          bool
+}
+
+// Replayer acts as the server of a recorded session. Each request is
+// answered with the response to a recorded request with the same method,
+// preferring ones not replayed yet and then ones with the same params, and
+// preceded by the notifications the server sent while the original was in
+// progress.
+type Replayer struct {
+	exchanges []*exchange
+}
+
+func NewReplayer(recording []RecordedMessage) *Replayer {
+	r := &Replayer{}
+	open := map[string]*exchange{}
+	var current *exchange
+	for _, entry := range recording {
+		msg := entry.Message
+		switch {
+		case entry.Direction == ClientToServer && msg.IsRequest():
+			ex := &exchange{request: msg}
+			r.exchanges = append(r.exchanges, ex)
+			open[idKey(msg.ID)] = ex
+			current = ex
+		case entry.Direction == ServerToClient && msg.IsResponse():
+			if ex, ok := open[idKey(msg.ID)]; ok {
+				ex.response = msg
+				delete(open, idKey(msg.ID))
+				if current == ex {
+					current = nil
+				}
+			}
+		case entry.Direction == ServerToClient && msg.IsNotification() && current != nil:
+			current.notifications = append(current.notifications, msg)
+		}
+	}
+	return r
+}
+
+// Serve answers the requests received on conn until it closes or ctx is
+// done.
+func (r *Replayer) Serve(ctx context.Context, conn Conn) error {
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		msg, err := conn.Receive()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !msg.IsRequest() {
+			continue
+		}
+
+		ex := r.match(msg)
+		if ex == nil {
+			conn.Send(ctx, NewError(msg.ID, CodeInternalError, "no recorded response for '%s'", msg.Method))
+			continue
+		}
+		for _, notification := range ex.notifications {
+			conn.Send(ctx, notification)
+		}
+		response := *ex.response
+		response.ID = msg.ID
+		conn.Send(ctx, &response)
+	}
+}
+
+func (r *Replayer) match(msg *Message) *exchange {
+	params := canonicalJSON(msg.Params)
+	var best *exchange
+	bestRank := 0
+	for _, ex := range r.exchanges {
+		if ex.response == nil || ex.request.Method != msg.Method {
+			continue
+		}
+		rank := 1
+		if canonicalJSON(ex.request.Params) == params {
+			rank++
+		}
+		if !ex.used {
+			rank += 2
+		}
+		if rank > bestRank {
+			best, bestRank = ex, rank
+		}
+	}
+	if best != nil {
+		best.used = true
+	}
+	return best
+}
+
+// canonicalJSON re-encodes raw with sorted keys so that equal values compare
+// equal.
+func canonicalJSON(raw json.RawMessage) string {
+	var value interface{}
+	if len(raw) == 0 || json.Unmarshal(raw, &value) != nil {
+		return string(raw)
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
@@ -0,0 +1,109 @@
+package bridge
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// Backend states reported by Gateway.Status.
+const (
+	StateStarting   = "starting"
+	StateRunning    = "running"
+	StateRestarting = "restarting"
+	StateStopped    = "stopped"
+	// StateFailed is a running backend disabled because its tools collide
+	// with another backend's.
+	StateFailed = "failed"
+)
+
+// Restart backoff: the delay doubles with each failure in a row, from
+// minBackoff up to maxBackoff. A backend that ran for stableAfter starts
+// over at minBackoff.
+const (
+	minBackoff  = time.Second
+	maxBackoff  = time.Minute
+	stableAfter = time.Minute
+)
+
+// BackendStatus describes one backend of a gateway.
+type BackendStatus struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	PID       int       `json:"pid,omitempty"`
+	Restarts  int       `json:"restarts"`
+	Since     time.Time `json:"since"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Status returns the status of every backend, sorted by name.
+func (g *Gateway) Status() []BackendStatus {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	result := make([]BackendStatus, 0, len(g.status))
+	for _, st := range g.status {
+		result = append(result, *st)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// setStatus updates a backend's status and reports the change. A change of
+// state also resets Since.
+func (g *Gateway) setStatus(name string, update func(*BackendStatus)) {
+	g.mu.Lock()
+	st := g.status[name]
+	state := st.State
+	update(st)
+	if st.State != state {
+		st.Since = time.Now().UTC()
+	}
+	hook := g.OnStatusChange
+	g.mu.Unlock()
+	if hook != nil {
+		hook()
+	}
+}
+
+// restart reconnects to a backend after a backoff delay, retrying until it
+// succeeds, the gateway's context is done or the gateway is closed.
+func (g *Gateway) restart(backend Backend) {
+	for {
+		g.mu.Lock()
+		delay := g.minBackoff << g.failures[backend.Name]
+		if delay > g.maxBackoff || delay <= 0 {
+			delay = g.maxBackoff
+		}
+		g.failures[backend.Name]++
+		ctx := g.ctx
+		g.mu.Unlock()
+		g.setStatus(backend.Name, func(st *BackendStatus) {
+			st.State = StateRestarting
+			st.Restarts++
+		})
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-g.stopped:
+			timer.Stop()
+			return
+		}
+
+		err := g.connect(ctx, backend)
+		if err == nil {
+			log.Printf("server '%s' restarted", backend.Name)
+			g.mu.Lock()
+			conflict := g.reindex(backend.Name)
+			g.mu.Unlock()
+			g.reportConflict(backend.Name, conflict)
+			g.broadcastListChanged()
+			return
+		}
+		log.Printf("server '%s': restart failed: %v", backend.Name, err)
+		g.setStatus(backend.Name, func(st *BackendStatus) { st.LastError = err.Error() })
+	}
+}
@@ -2,50 +2,167 @@ package mcp
 
 import (
 	"fmt"
-	"strings"
+	"path/filepath"
 )
 
-func ApplyAdapter(adapter AdapterConfig, servers map[string]ServerConfig) (map[string]interface{}, error) {
+// Entry is one server's rendered configuration within a generated file.
+type Entry struct {
+	Name   string
+	Config map[string]interface{}
+	// Server is the resolved canonical definition the entry was built from.
+	Server ServerConfig
+}
+
+func ApplyAdapter(adapter AdapterConfig, servers map[string]ServerConfig, globals Globals) (map[string]interface{}, error) {
 	if adapter.Server == "" {
 		return nil, fmt.Errorf("adapter for tool '%s' is missing 'server' field", adapter.Tool)
 	}
 
-	serverConfig, ok := servers[adapter.Server]
-	if !ok {
+	if _, ok := servers[adapter.Server]; !ok {
 		return nil, fmt.Errorf("adapter for tool '%s' targets unknown server '%s'", adapter.Tool, adapter.Server)
 	}
+	serverConfig, err := adapter.resolveServer(adapter.Server, servers, globals)
+	if err != nil {
+		return nil, err
+	}
+
+	return applyToServer(adapter, adapter.Server, serverConfig, globals)
+}
+
+// ApplyAdapterEntries applies the adapter's mapping to every server it
+// targets. A single 'server' adapter yields one entry named after the
+// mapping's "name" field or the tool; a 'servers' adapter yields one entry
+// per server, named after the server.
+func ApplyAdapterEntries(adapter AdapterConfig, servers map[string]ServerConfig, globals Globals) ([]Entry, error) {
+	names, err := adapter.selectedServers(servers)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(names))
+	for _, name := range names {
+		serverConfig, err := adapter.resolveServer(name, servers, globals)
+		if err != nil {
+			return nil, err
+		}
+
+		var pathServer ServerConfig
+		if adapter.Layout == "per_server" {
+			pathServer = serverConfig
+		}
+		outputPath, err := adapter.ResolveOutputPath(globals, pathServer)
+		if err != nil {
+			return nil, err
+		}
+
+		config, err := applyToServer(adapter, name, serverConfig, globals.WithOutputDir(filepath.Dir(outputPath)))
+		if err != nil {
+			return nil, err
+		}
+
+		entryName := name
+		if len(adapter.Servers) == 0 {
+			entryName = adapter.Tool
+		}
+		if configName, ok := config["name"].(string); ok && configName != "" {
+			entryName = configName
+		}
+		entries = append(entries, Entry{Name: entryName, Config: config, Server: serverConfig})
+	}
+	return entries, nil
+}
+
+// applyToServer renders the adapter's mapping for a server whose
+// placeholders resolveServer has already expanded; expanding them again would
+// turn escaped braces back into placeholders.
+func applyToServer(adapter AdapterConfig, name string, serverConfig ServerConfig, globals Globals) (map[string]interface{}, error) {
+	mapping, mappingPath, serverConfig, err := selectMapping(adapter, name, serverConfig)
+	if err != nil {
+		return nil, err
+	}
 
-	return substitute(adapter.Mapping, serverConfig).(map[string]interface{}), nil
+	result, err := substitute(mapping, globals.scope(serverConfig), mappingPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w (server '%s')", adapter.describe(), err, name)
+	}
+	return result.(map[string]interface{}), nil
 }
 
-func substitute(value interface{}, serverConfig ServerConfig) interface{} {
+// selectMapping picks the mapping template that applies to the server's
+// transport, along with its location in the adapter file for error messages.
+// A remote server the client cannot launch directly is rewritten into a
+// stdio server: through mcp-remote if it requires OAuth that the adapter
+// does not handle, or through "mcp-bridge proxy" if the client
+// does not support its transport. The server to map is returned alongside
+// the mapping.
+func selectMapping(adapter AdapterConfig, name string, serverConfig ServerConfig) (map[string]interface{}, string, ServerConfig, error) {
+	transport, _ := serverConfig["transport"].(string)
+	_, hasAuth := serverConfig["auth"]
+
+	if !adapter.supportsTransport(transport) {
+		if transport == "stdio" || !adapter.supportsTransport("stdio") {
+			return nil, "", nil, fmt.Errorf("adapter for tool '%s' does not support transport '%s' and cannot wrap it in stdio (server '%s')", adapter.Tool, transport, name)
+		}
+		if hasAuth {
+			serverConfig = oauthWrapper(serverConfig)
+		} else {
+			serverConfig = proxyWrapper(serverConfig)
+		}
+		transport = "stdio"
+	}
+
+	if len(adapter.MappingByTransport) == 0 {
+		return adapter.Mapping, "mapping", serverConfig, nil
+	}
+
+	mapping, ok := adapter.MappingByTransport[transport]
+	if !ok {
+		return nil, "", nil, fmt.Errorf("adapter for tool '%s' has no mapping for transport '%s' (server '%s')", adapter.Tool, transport, name)
+	}
+
+	if transport != "stdio" && hasAuth && !adapter.handles("auth", mapping) {
+		if stdio, ok := adapter.MappingByTransport["stdio"]; ok {
+			return stdio, "mapping_by_transport.stdio", oauthWrapper(serverConfig), nil
+		}
+	}
+	return mapping, "mapping_by_transport." + transport, serverConfig, nil
+}
+
+func substitute(value interface{}, scope map[string]interface{}, path string) (interface{}, error) {
 	switch v := value.(type) {
 	case string:
-		for key, val := range serverConfig {
-			placeholder := fmt.Sprintf("{{%s}}", key)
-			if strings.Contains(v, placeholder) {
-				// If the value is exactly the placeholder, return the original value (preserving type)
-				if v == placeholder {
-					return val
-				}
-				// Otherwise, replace as string
-				v = strings.ReplaceAll(v, placeholder, fmt.Sprintf("%v", val))
-			}
+		expanded, err := expandString(v, scope)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
 		}
-		return v
+		return expanded, nil
 	case map[string]interface{}:
 		result := make(map[string]interface{})
 		for k, val := range v {
-			result[k] = substitute(val, serverConfig)
+			expanded, err := substitute(val, scope, path+"."+k)
+			if err != nil {
+				return nil, err
+			}
+			if expanded == omitted {
+				continue
+			}
+			result[k] = expanded
 		}
-		return result
+		return result, nil
 	case []interface{}:
-		result := make([]interface{}, len(v))
+		result := make([]interface{}, 0, len(v))
 		for i, val := range v {
-			result[i] = substitute(val, serverConfig)
+			expanded, err := substitute(val, scope, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			if expanded == omitted {
+				continue
+			}
+			result = append(result, expanded)
 		}
-		return result
+		return result, nil
 	default:
-		return v
+		return v, nil
 	}
 }
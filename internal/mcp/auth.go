@@ -0,0 +1,89 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// oauthWrapper rewrites a remote server that requires OAuth into a stdio
+// server launching mcp-remote, which runs the OAuth flow on behalf of
+// clients that cannot. Client credentials and scopes are passed as static
+// client information; endpoints are discovered by mcp-remote.
+func oauthWrapper(serverConfig ServerConfig) ServerConfig {
+	auth, _ := serverConfig["auth"].(map[string]interface{})
+
+	transport := "http-only"
+	if serverConfig["transport"] == "sse" {
+		transport = "sse-only"
+	}
+	args := []interface{}{"-y", "mcp-remote", serverConfig["url"], "--transport", transport}
+
+	args = append(args, headerArgs(serverConfig)...)
+
+	clientInfo := map[string]interface{}{}
+	for _, field := range []string{"client_id", "client_secret"} {
+		if value, ok := auth[field]; ok {
+			clientInfo[field] = value
+		}
+	}
+	if len(clientInfo) > 0 {
+		encoded, _ := json.Marshal(clientInfo)
+		args = append(args, "--static-oauth-client-info", string(encoded))
+	}
+	if scopes, ok := auth["scopes"].([]interface{}); ok && len(scopes) > 0 {
+		names := make([]string, len(scopes))
+		for i, scope := range scopes {
+			names[i] = fmt.Sprintf("%v", scope)
+		}
+		encoded, _ := json.Marshal(map[string]string{"scope": strings.Join(names, " ")})
+		args = append(args, "--static-oauth-client-metadata", string(encoded))
+	}
+
+	return stdioWrapper(serverConfig, "npx", args)
+}
+
+// proxyWrapper rewrites a remote server into a stdio server launching
+// "mcp-bridge proxy", for clients that cannot connect to its transport.
+func proxyWrapper(serverConfig ServerConfig) ServerConfig {
+	args := []interface{}{"proxy", "--url", serverConfig["url"]}
+	if serverConfig["transport"] == "sse" {
+		args = append(args, "--transport", "sse")
+	}
+	args = append(args, headerArgs(serverConfig)...)
+	return stdioWrapper(serverConfig, "mcp-bridge", args)
+}
+
+// headerArgs passes the server's headers as sorted --header name:value flags.
+func headerArgs(serverConfig ServerConfig) []interface{} {
+	headers, _ := serverConfig["headers"].(map[string]interface{})
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var args []interface{}
+	for _, key := range keys {
+		args = append(args, "--header", fmt.Sprintf("%s:%v", key, headers[key]))
+	}
+	return args
+}
+
+// stdioWrapper replaces the remote connection fields of serverConfig with
+// a stdio command, keeping everything else.
+func stdioWrapper(serverConfig ServerConfig, command string, args []interface{}) ServerConfig {
+	wrapped := make(ServerConfig, len(serverConfig)+2)
+	for key, value := range serverConfig {
+		switch key {
+		case "url", "headers", "auth":
+		default:
+			wrapped[key] = value
+		}
+	}
+	wrapped["transport"] = "stdio"
+	wrapped["command"] = command
+	wrapped["args"] = args
+	return wrapped
+}
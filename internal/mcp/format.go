@@ -0,0 +1,177 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Format encodes generated configs to, and parses rendered output from, one
+// file format. Encoders must be deterministic: map keys are written sorted.
+type Format interface {
+	Encode(data interface{}) ([]byte, error)
+	Decode(content []byte) (interface{}, error)
+}
+
+var formats = map[string]Format{}
+
+// RegisterFormat makes a format available to adapters as format_type name.
+func RegisterFormat(name string, format Format) {
+	formats[name] = format
+}
+
+// LookupFormat returns the format registered as name; "" means JSON.
+func LookupFormat(name string) (Format, error) {
+	if name == "" {
+		name = "json"
+	}
+	format, ok := formats[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported format_type '%s' (available: %v)", name, FormatNames())
+	}
+	return format, nil
+}
+
+func FormatNames() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterFormat("json", jsonFormat{})
+	RegisterFormat("toml", tomlFormat{})
+	RegisterFormat("yaml", yamlFormat{})
+}
+
+type jsonFormat struct{}
+
+func (jsonFormat) Encode(data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (jsonFormat) Decode(content []byte) (interface{}, error) {
+	var parsed interface{}
+	err := json.Unmarshal(content, &parsed)
+	return parsed, err
+}
+
+type tomlFormat struct{}
+
+func (tomlFormat) Encode(data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (tomlFormat) Decode(content []byte) (interface{}, error) {
+	var parsed interface{}
+	err := toml.Unmarshal(content, &parsed)
+	return parsed, err
+}
+
+type yamlFormat struct{}
+
+func (yamlFormat) Encode(data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(data); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (yamlFormat) Decode(content []byte) (interface{}, error) {
+	var parsed interface{}
+	err := yaml.Unmarshal(content, &parsed)
+	return parsed, err
+}
+
+// stripJSONC removes // and /* */ comments and trailing commas from JSON
+// with comments, leaving string contents untouched.
+func stripJSONC(content []byte) []byte {
+	return stripTrailingCommas(stripComments(content))
+}
+
+func stripComments(content []byte) []byte {
+	var out bytes.Buffer
+	inString := false
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case inString:
+			out.WriteByte(c)
+			if c == '\\' && i+1 < len(content) {
+				i++
+				out.WriteByte(content[i])
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+			out.WriteByte(c)
+		case c == '/' && i+1 < len(content) && content[i+1] == '/':
+			for i+1 < len(content) && content[i+1] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(content) && content[i+1] == '*':
+			end := bytes.Index(content[i+2:], []byte("*/"))
+			if end < 0 {
+				return out.Bytes()
+			}
+			i += end + 3
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes()
+}
+
+func stripTrailingCommas(content []byte) []byte {
+	var out bytes.Buffer
+	inString := false
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case inString:
+			out.WriteByte(c)
+			if c == '\\' && i+1 < len(content) {
+				i++
+				out.WriteByte(content[i])
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+			out.WriteByte(c)
+		case c == ',':
+			next := bytes.TrimLeft(content[i+1:], " \t\r\n")
+			if len(next) > 0 && (next[0] == '}' || next[0] == ']') {
+				continue
+			}
+			out.WriteByte(c)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes()
+}
@@ -1,86 +1,263 @@
 package mcp
 
 import (
-	"encoding/json"
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-
-	"github.com/pelletier/go-toml/v2"
 )
 
 func GenerateMCPJson(servers map[string]ServerConfig, outputPath string) error {
 	mcpConfig := map[string]interface{}{
 		"mcpServers": servers,
 	}
-	return writeJson(outputPath, mcpConfig)
+	return writeFormat(outputPath, "json", mcpConfig)
+}
+
+// GenerateToolConfig writes the adapter's entries and returns the paths it
+// wrote. Adapters with the "per_server" layout write one file per entry,
+// with output_path expanded against that entry's server.
+func GenerateToolConfig(adapter AdapterConfig, entries []Entry, globals Globals) ([]string, error) {
+	format, err := LookupFormat(adapter.FormatType)
+	if err != nil {
+		return nil, err
+	}
+
+	if adapter.Layout != "per_server" {
+		outputPath, err := adapter.ResolveOutputPath(globals, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeDocument(adapter, format, entries, outputPath, globals.scope(nil)); err != nil {
+			return nil, err
+		}
+		return []string{outputPath}, nil
+	}
+
+	var written []string
+	for _, entry := range entries {
+		outputPath, err := adapter.ResolveOutputPath(globals, entry.Server)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeDocument(adapter, format, []Entry{entry}, outputPath, globals.scope(entry.Server)); err != nil {
+			return nil, err
+		}
+		written = append(written, outputPath)
+	}
+	return written, nil
 }
 
-func GenerateToolConfig(toolName string, config map[string]interface{}, formatKey string, outputPath string, useTOML bool) error {
+func writeDocument(adapter AdapterConfig, format Format, entries []Entry, outputPath string, scope map[string]interface{}) error {
+	document, err := BuildDocument(entries, adapter.insertPath(), adapter.Container)
+	if err != nil {
+		return fmt.Errorf("%s: %w", adapter.describe(), err)
+	}
+
+	if len(adapter.Document) > 0 {
+		header, err := substitute(adapter.Document, scope, "document")
+		if err != nil {
+			return fmt.Errorf("%s: %w", adapter.describe(), err)
+		}
+		document = deepMerge(header.(map[string]interface{}), document)
+	}
+
+	if err := applyRenderer(adapter.Renderer, document, entries); err != nil {
+		return fmt.Errorf("%s: %w", adapter.describe(), err)
+	}
+
+	if adapter.Merge {
+		merge := mergeCollection
+		if custom, ok := rendererMerges[adapter.Renderer]; ok {
+			merge = func(existing, generated interface{}) interface{} { return custom(existing, generated, entries) }
+		}
+		document, err = mergeExisting(outputPath, format, document, adapter.insertPath(), merge)
+		if err != nil {
+			return fmt.Errorf("%s: %w", adapter.describe(), err)
+		}
+	}
+
 	// Ensure directory exists
 	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
 		return fmt.Errorf("failed to create directory for %s: %w", outputPath, err)
 	}
 
-	// If formatKey is empty, default to "mcpServers" to match Python behavior
-	if formatKey == "" {
-		formatKey = "mcpServers"
+	if adapter.Merge {
+		return writeMerged(outputPath, format, document, adapter.insertPath())
 	}
+	return writeEncoded(outputPath, format, document)
+}
 
-	name, ok := config["name"].(string)
-	if !ok || name == "" {
-		name = toolName
+// BuildDocument nests the entries under insertPath. Each path element is a
+// literal key, so ["amp.mcpServers"] is one key containing a dot. With the
+// "map" container (the default) entries are keyed by name; with "array"
+// they become a list of objects carrying a "name" field.
+func BuildDocument(entries []Entry, insertPath []string, container string) (map[string]interface{}, error) {
+	if len(insertPath) == 0 {
+		return nil, fmt.Errorf("insert_path must not be empty")
 	}
 
-	var finalOutput map[string]interface{}
-
-	if useTOML {
-		// For Codex TOML, it seems the format is [mcp_servers.<name>]
-		// So we structure it accordingly.
-		finalOutput = map[string]interface{}{
-			"mcp_servers": map[string]interface{}{
-				name: config,
-			},
+	var collection interface{}
+	switch container {
+	case "", "map":
+		servers := make(map[string]interface{}, len(entries))
+		for _, entry := range entries {
+			if _, exists := servers[entry.Name]; exists {
+				return nil, fmt.Errorf("duplicate entry name '%s'", entry.Name)
+			}
+			servers[entry.Name] = entry.Config
+		}
+		collection = servers
+	case "array":
+		servers := make([]interface{}, 0, len(entries))
+		for _, entry := range entries {
+			item := make(map[string]interface{}, len(entry.Config)+1)
+			item["name"] = entry.Name
+			for k, v := range entry.Config {
+				item[k] = v
+			}
+			servers = append(servers, item)
 		}
-		return writeToml(outputPath, finalOutput)
+		collection = servers
+	default:
+		return nil, fmt.Errorf("unsupported container '%s' (expected \"map\" or \"array\")", container)
 	}
 
-	finalOutput = map[string]interface{}{
-		formatKey: map[string]interface{}{
-			name: config,
-		},
+	document := map[string]interface{}{}
+	current := document
+	for _, key := range insertPath[:len(insertPath)-1] {
+		next := map[string]interface{}{}
+		current[key] = next
+		current = next
 	}
-
-	return writeJson(outputPath, finalOutput)
+	current[insertPath[len(insertPath)-1]] = collection
+	return document, nil
 }
 
-func writeJson(path string, data interface{}) error {
-	file, err := os.Create(path)
+// mergeExisting folds a generated document into the file already at
+// outputPath. Unrelated settings and entries the bridge did not generate are
+// kept; generated entries replace existing ones of the same name, or the
+// collection is combined by merge if the renderer needs it. JSON files
+// may contain comments and trailing commas, as editor settings often do.
+func mergeExisting(outputPath string, format Format, document map[string]interface{}, insertPath []string, merge func(existing, generated interface{}) interface{}) (map[string]interface{}, error) {
+	content, err := os.ReadFile(outputPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return document, nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create file %s: %w", path, err)
+		return nil, fmt.Errorf("failed to read file %s: %w", outputPath, err)
+	}
+	if _, ok := format.(jsonFormat); ok {
+		content = stripJSONC(content)
+	}
+	if len(bytes.TrimSpace(content)) == 0 {
+		return document, nil
+	}
+
+	parsed, err := format.Decode(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse existing %s: %w", outputPath, err)
+	}
+	existing, ok := parsed.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("existing %s is not an object", outputPath)
+	}
+
+	// Merge the collection separately so entries are replaced whole rather
+	// than deep-merged with stale fields.
+	var existingCollection interface{}
+	target := existing
+	for i, key := range insertPath {
+		if i == len(insertPath)-1 {
+			existingCollection = target[key]
+			break
+		}
+		next, ok := target[key].(map[string]interface{})
+		if !ok {
+			break
+		}
+		target = next
 	}
-	defer file.Close()
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(data); err != nil {
-		return fmt.Errorf("failed to encode JSON to %s: %w", path, err)
+	merged := deepMerge(existing, document)
+
+	target = merged
+	source := document
+	for _, key := range insertPath[:len(insertPath)-1] {
+		target = target[key].(map[string]interface{})
+		source = source[key].(map[string]interface{})
 	}
+	last := insertPath[len(insertPath)-1]
+	target[last] = merge(existingCollection, source[last])
+	return merged, nil
+}
 
+// mergeCollection adds the generated entries to an existing map or array
+// collection, replacing entries with the same name.
+func mergeCollection(existing, generated interface{}) interface{} {
+	switch gen := generated.(type) {
+	case map[string]interface{}:
+		current, ok := existing.(map[string]interface{})
+		if !ok {
+			return gen
+		}
+		result := make(map[string]interface{}, len(current)+len(gen))
+		for k, v := range current {
+			result[k] = v
+		}
+		for k, v := range gen {
+			result[k] = v
+		}
+		return result
+	case []interface{}:
+		current, ok := existing.([]interface{})
+		if !ok {
+			return gen
+		}
+		names := make(map[interface{}]bool, len(gen))
+		for _, item := range gen {
+			names[item.(map[string]interface{})["name"]] = true
+		}
+		var result []interface{}
+		for _, item := range current {
+			if m, ok := item.(map[string]interface{}); ok && names[m["name"]] {
+				continue
+			}
+			result = append(result, item)
+		}
+		return append(result, gen...)
+	default:
+		return generated
+	}
+}
+
+// WriteRendered writes content produced by a template adapter to outputPath.
+func WriteRendered(outputPath string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", outputPath, err)
+	}
+	if err := os.WriteFile(outputPath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", outputPath, err)
+	}
 	return nil
 }
 
-func writeToml(path string, data interface{}) error {
-	file, err := os.Create(path)
+func writeFormat(path string, formatType string, data interface{}) error {
+	format, err := LookupFormat(formatType)
 	if err != nil {
-		return fmt.Errorf("failed to create file %s: %w", path, err)
+		return err
 	}
-	defer file.Close()
+	return writeEncoded(path, format, data)
+}
 
-	encoder := toml.NewEncoder(file)
-	if err := encoder.Encode(data); err != nil {
-		return fmt.Errorf("failed to encode TOML to %s: %w", path, err)
+func writeEncoded(path string, format Format, data interface{}) error {
+	content, err := format.Encode(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
 	}
-
 	return nil
 }
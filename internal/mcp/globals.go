@@ -0,0 +1,77 @@
+package mcp
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// Globals holds the template values available to every placeholder besides
+// the target server's own fields: user variables under "vars" and the
+// built-ins repo_root, output_dir, home and os. Server fields of the same
+// name take precedence.
+type Globals map[string]interface{}
+
+func NewGlobals(repoRoot string, vars map[string]interface{}) Globals {
+	if vars == nil {
+		vars = map[string]interface{}{}
+	}
+	home, _ := os.UserHomeDir()
+	return Globals{
+		"vars":       vars,
+		"repo_root":  repoRoot,
+		"output_dir": repoRoot,
+		"home":       home,
+		"os":         runtime.GOOS,
+	}
+}
+
+// WithOutputDir returns a copy of g whose output_dir is dir.
+func (g Globals) WithOutputDir(dir string) Globals {
+	result := make(Globals, len(g)+1)
+	for k, v := range g {
+		result[k] = v
+	}
+	result["output_dir"] = dir
+	return result
+}
+
+// scope merges the globals with a server's fields for placeholder lookup.
+func (g Globals) scope(serverConfig ServerConfig) map[string]interface{} {
+	result := make(map[string]interface{}, len(g)+len(serverConfig))
+	for k, v := range g {
+		result[k] = v
+	}
+	for k, v := range serverConfig {
+		result[k] = v
+	}
+	return result
+}
+
+// ResolveServer expands vars and built-ins used inside a server definition.
+func ResolveServer(serverConfig ServerConfig, globals Globals) (ServerConfig, error) {
+	resolved := make(ServerConfig, len(serverConfig))
+	for k, v := range serverConfig {
+		expanded, err := substitute(v, globals.scope(nil), k)
+		if err != nil {
+			return nil, fmt.Errorf("server '%v': %w", serverConfig["name"], err)
+		}
+		if expanded == omitted {
+			continue
+		}
+		resolved[k] = expanded
+	}
+	return resolved, nil
+}
+
+func ResolveServers(servers map[string]ServerConfig, globals Globals) (map[string]ServerConfig, error) {
+	resolved := make(map[string]ServerConfig, len(servers))
+	for name, serverConfig := range servers {
+		r, err := ResolveServer(serverConfig, globals)
+		if err != nil {
+			return nil, err
+		}
+		resolved[name] = r
+	}
+	return resolved, nil
+}
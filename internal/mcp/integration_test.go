@@ -111,6 +111,33 @@ func TestIntegration_CorrectFileLocations(t *testing.T) {
       "url": "https://gitlab.com/api/v4/mcp"
     }
   }
+}`,
+		},
+		{
+			path: ".vscode/mcp.json",
+			ext:  ".json",
+			expectContent: `{
+  "inputs": [],
+  "servers": {
+    "example_http": {
+      "type": "http",
+      "url": "http://localhost:3333/mcp"
+    },
+    "example_stdio": {
+      "type": "stdio",
+      "command": "node",
+      "args": [
+        "./tools/example.js"
+      ],
+      "env": {
+        "EXAMPLE_MODE": "demo"
+      }
+    },
+    "gitlab": {
+      "type": "http",
+      "url": "https://gitlab.com/api/v4/mcp"
+    }
+  }
 }`,
 		},
 		{
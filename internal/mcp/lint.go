@@ -0,0 +1,97 @@
+package mcp
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Lint checks every adapter against each server it targets and reports all
+// problems found, rather than stopping at the first one as generation does.
+// Problems are reported in a stable order so that output can be compared.
+func Lint(adapters []AdapterConfig, servers map[string]ServerConfig, globals Globals) []error {
+	var problems []error
+
+	for _, adapter := range adapters {
+		if adapter.Tool == "" {
+			continue
+		}
+		if adapter.Type == "exec" {
+			if len(adapter.Command) == 0 {
+				problems = append(problems, fmt.Errorf("%s: exec adapter is missing 'command'", adapter.describe()))
+			} else if _, err := adapter.selectedServers(servers); err != nil {
+				problems = append(problems, err)
+			}
+			continue
+		}
+		if adapter.Template != "" {
+			if _, err := RenderTemplate(adapter, servers, globals); err != nil {
+				problems = append(problems, err)
+			}
+			continue
+		}
+
+		keys := make([]string, 0, len(adapter.Overrides))
+		for key := range adapter.Overrides {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if _, ok := servers[key]; !ok && key != "*" {
+				problems = append(problems, fmt.Errorf("%s: overrides unknown server '%s'", adapter.describe(), key))
+			}
+		}
+
+		names, err := adapter.selectedServers(servers)
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+
+		for _, name := range names {
+			serverConfig, err := adapter.resolveServer(name, servers, globals)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("%s: %w", adapter.describe(), err))
+				continue
+			}
+
+			mapping, mappingPath, serverConfig, err := selectMapping(adapter, name, serverConfig)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("%s: %w", adapter.describe(), err))
+				continue
+			}
+
+			for _, err := range lintValue(mapping, globals.scope(serverConfig), mappingPath) {
+				problems = append(problems, fmt.Errorf("%s: %w (server '%s')", adapter.describe(), err, name))
+			}
+		}
+	}
+
+	return problems
+}
+
+// lintValue expands every string in value and collects the failures.
+func lintValue(value interface{}, scope map[string]interface{}, path string) []error {
+	var problems []error
+
+	switch v := value.(type) {
+	case string:
+		if _, err := expandString(v, scope); err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", path, err))
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			problems = append(problems, lintValue(v[k], scope, path+"."+k)...)
+		}
+	case []interface{}:
+		for i, val := range v {
+			problems = append(problems, lintValue(val, scope, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+
+	return problems
+}
@@ -2,6 +2,7 @@ package mcp
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -53,27 +54,271 @@ func LoadServers(serversDir string) (map[string]ServerConfig, error) {
 			if _, ok := config["command"]; !ok {
 				return nil, fmt.Errorf("server '%s' (stdio) is missing 'command'", name)
 			}
-		} else if transport == "http" {
+		} else if transport == "http" || transport == "sse" {
 			if _, ok := config["url"]; !ok {
-				return nil, fmt.Errorf("server '%s' (http) is missing 'url'", name)
+				return nil, fmt.Errorf("server '%s' (%s) is missing 'url'", name, transport)
 			}
 		} else {
 			return nil, fmt.Errorf("server '%s' has unsupported transport: %s", name, transport)
 		}
 
+		if err := validateServerFields(name, config); err != nil {
+			return nil, err
+		}
+
 		servers[name] = config
 	}
 
 	return servers, nil
 }
 
+// LoadVars reads the template variables in mcpDir/vars.json and, when a
+// profile is given, deep-merges mcpDir/vars.<profile>.json over them.
+// vars.json is optional; a named profile file must exist.
+func LoadVars(mcpDir string, profile string) (map[string]interface{}, error) {
+	vars := make(map[string]interface{})
+
+	if err := readJSONFile(filepath.Join(mcpDir, "vars.json"), &vars); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if profile == "" {
+		return vars, nil
+	}
+
+	var overrides map[string]interface{}
+	if err := readJSONFile(filepath.Join(mcpDir, fmt.Sprintf("vars.%s.json", profile)), &overrides); err != nil {
+		return nil, fmt.Errorf("failed to load profile '%s': %w", profile, err)
+	}
+	return deepMerge(vars, overrides), nil
+}
+
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse JSON from %s: %w", path, err)
+	}
+	return nil
+}
+
+// deepMerge returns base with overrides applied, merging nested maps.
+func deepMerge(base, overrides map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(base))
+	for k, v := range base {
+		result[k] = v
+	}
+	for k, v := range overrides {
+		baseMap, baseOK := result[k].(map[string]interface{})
+		overrideMap, overrideOK := v.(map[string]interface{})
+		if baseOK && overrideOK {
+			result[k] = deepMerge(baseMap, overrideMap)
+			continue
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// ServerSelection lists the servers an adapter targets. In JSON it is
+// either a list of server names or the string "*" for every server.
+type ServerSelection []string
+
+func (s *ServerSelection) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*s = ServerSelection{name}
+		return nil
+	}
+
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return fmt.Errorf("'servers' must be \"*\" or a list of server names")
+	}
+	*s = names
+	return nil
+}
+
 type AdapterConfig struct {
-	Tool       string                 `json:"tool"`
-	Server     string                 `json:"server"`
-	Format     string                 `json:"format"`
-	Mapping    map[string]interface{} `json:"mapping"`
-	OutputPath string                 `json:"output_path"`
-	FormatType string                 `json:"format_type"` // "json" or "toml"
+	Tool string `json:"tool"`
+
+	// Preset names a built-in adapter definition this one is merged over,
+	// optionally pinned to a version as "name@version".
+	Preset        string `json:"preset"`
+	PresetVersion int    `json:"preset_version"`
+	Description   string `json:"description"`
+
+	Server  string                 `json:"server"`
+	Servers ServerSelection        `json:"servers"`
+	Format  string                 `json:"format"`
+	Mapping map[string]interface{} `json:"mapping"`
+
+	// Overrides are deep-merged into server definitions for this adapter
+	// only, keyed by server name or "*" for every server.
+	Overrides map[string]map[string]interface{} `json:"overrides"`
+
+	// MappingByTransport holds one mapping per server transport ("stdio",
+	// "http", "sse"). When present it takes precedence over Mapping.
+	MappingByTransport map[string]map[string]interface{} `json:"mapping_by_transport"`
+
+	// Transports lists the transports the client can launch. Servers using
+	// any other transport are wrapped in a stdio proxy; empty means all.
+	Transports []string `json:"transports"`
+
+	// Template is the path, relative to the adapter file, of a text/template
+	// rendered instead of applying a mapping.
+	Template string `json:"template"`
+
+	// Type "exec" delegates rendering to an external Command; see RunPlugin.
+	Type     string                 `json:"type"`
+	Command  []string               `json:"command"`
+	Timeout  string                 `json:"timeout"`
+	Output   string                 `json:"output"` // "content" (default) or "files"
+	Settings map[string]interface{} `json:"settings"`
+
+	OutputPath string `json:"output_path"`
+	FormatType string `json:"format_type"` // "json", "toml" or "yaml"
+
+	// InsertPath is where generated entries are nested in the output file,
+	// one literal key per element. It defaults to [Format].
+	InsertPath []string `json:"insert_path"`
+	Container  string   `json:"container"` // "map" (default) or "array"
+
+	// Renderer names a built-in post-processing step; see renderers.go.
+	Renderer string `json:"renderer"`
+
+	// Merge keeps the rest of an existing output file, replacing only the
+	// generated entries at InsertPath.
+	Merge bool `json:"merge"`
+
+	// Layout "per_server" writes one file per server; OutputPath then
+	// usually contains {{name}}.
+	Layout string `json:"layout"`
+
+	// Document holds extra top-level fields for each generated file, with
+	// placeholders resolved against the file's server for per_server layouts.
+	Document map[string]interface{} `json:"document"`
+
+	// Source is the file the adapter was loaded from.
+	Source string `json:"-"`
+}
+
+// resolveServer returns the named server with the adapter's overrides
+// applied, "*" first and then the server's own, and placeholders expanded.
+func (a AdapterConfig) resolveServer(name string, servers map[string]ServerConfig, globals Globals) (ServerConfig, error) {
+	serverConfig := servers[name]
+	if len(a.Overrides) > 0 {
+		for _, key := range []string{"*", name} {
+			if override, ok := a.Overrides[key]; ok {
+				serverConfig = deepMerge(serverConfig, override)
+			}
+		}
+		if err := validateServerFields(name, serverConfig); err != nil {
+			return nil, fmt.Errorf("overrides: %w", err)
+		}
+	}
+	return ResolveServer(serverConfig, globals)
+}
+
+func (a AdapterConfig) supportsTransport(transport string) bool {
+	if len(a.Transports) == 0 {
+		return true
+	}
+	for _, t := range a.Transports {
+		if t == transport {
+			return true
+		}
+	}
+	return false
+}
+
+// selectedServers returns the names of the servers the adapter targets,
+// sorted by name, from either 'servers' or the single 'server' field.
+func (a AdapterConfig) selectedServers(servers map[string]ServerConfig) ([]string, error) {
+	if len(a.Servers) == 0 {
+		if a.Server == "" {
+			return nil, fmt.Errorf("%s: missing 'server' or 'servers' field", a.describe())
+		}
+		if _, ok := servers[a.Server]; !ok {
+			return nil, fmt.Errorf("%s: targets unknown server '%s'", a.describe(), a.Server)
+		}
+		return []string{a.Server}, nil
+	}
+
+	var names []string
+	for _, name := range a.Servers {
+		if name == "*" {
+			names = names[:0]
+			for serverName := range servers {
+				names = append(names, serverName)
+			}
+			break
+		}
+		if _, ok := servers[name]; !ok {
+			return nil, fmt.Errorf("%s: targets unknown server '%s'", a.describe(), name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ResolveOutputPath expands placeholders in output_path, which defaults to
+// .mcp.<tool>.json, and makes it absolute relative to repo_root. For the
+// per_server layout serverConfig is the server whose file is being written.
+func (a AdapterConfig) ResolveOutputPath(globals Globals, serverConfig ServerConfig) (string, error) {
+	outputPath := a.OutputPath
+	if outputPath == "" {
+		outputPath = fmt.Sprintf(".mcp.%s.json", a.Tool)
+	}
+
+	expanded, err := expandString(outputPath, globals.scope(serverConfig))
+	if err != nil {
+		return "", fmt.Errorf("%s: output_path: %w", a.describe(), err)
+	}
+	resolved, ok := expanded.(string)
+	if !ok || resolved == "" {
+		return "", fmt.Errorf("%s: output_path does not resolve to a path", a.describe())
+	}
+
+	if !filepath.IsAbs(resolved) {
+		repoRoot, _ := globals["repo_root"].(string)
+		resolved = filepath.Join(repoRoot, resolved)
+	}
+	return resolved, nil
+}
+
+// insertPath returns the configured insertion path, falling back to the
+// 'format' key: "mcpServers" by default, or "mcp_servers" for TOML, which
+// Codex configs have always used.
+func (a AdapterConfig) insertPath() []string {
+	if len(a.InsertPath) > 0 {
+		return a.InsertPath
+	}
+	if a.Format != "" {
+		return []string{a.Format}
+	}
+	if a.FormatType == "toml" {
+		return []string{"mcp_servers"}
+	}
+	return []string{"mcpServers"}
+}
+
+func (a AdapterConfig) formatType() string {
+	if a.FormatType == "" {
+		return "json"
+	}
+	return a.FormatType
+}
+
+// describe names the adapter in error messages, preferring its source file.
+func (a AdapterConfig) describe() string {
+	if a.Source != "" {
+		return a.Source
+	}
+	return fmt.Sprintf("adapter for tool '%s'", a.Tool)
 }
 
 func LoadAdapters(adaptersDir string) ([]AdapterConfig, error) {
@@ -100,22 +345,27 @@ func LoadAdapters(adaptersDir string) ([]AdapterConfig, error) {
 			return nil, fmt.Errorf("failed to read file %s: %w", path, err)
 		}
 
-		var config AdapterConfig
-		if err := json.Unmarshal(data, &config); err != nil {
+		var raw map[string]interface{}
+		if err := json.Unmarshal(data, &raw); err != nil {
 			return nil, fmt.Errorf("failed to parse JSON from %s: %w", path, err)
 		}
 
-		if config.Tool == "" {
-			// For untyped loading to check specific fields if needed
-			var raw map[string]interface{}
-			_ = json.Unmarshal(data, &raw)
-			if _, ok := raw["tool"]; !ok {
-				// Just skipping if no tool is present or handle as error?
-				// Python implementation skipped if no tool.
-				continue
-			}
+		raw, err = applyPreset(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load adapter %s: %w", path, err)
+		}
+		if _, ok := raw["tool"]; !ok {
+			// Python implementation skipped if no tool.
+			continue
+		}
+
+		merged, _ := json.Marshal(raw)
+		var config AdapterConfig
+		if err := json.Unmarshal(merged, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON from %s: %w", path, err)
 		}
 
+		config.Source = path
 		adapters = append(adapters, config)
 	}
 
@@ -2,9 +2,13 @@ package mcp
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadServers(t *testing.T) {
@@ -61,7 +65,7 @@ func TestApplyAdapter(t *testing.T) {
 		},
 	}
 
-	result, err := ApplyAdapter(adapter, servers)
+	result, err := ApplyAdapter(adapter, servers, nil)
 	if err != nil {
 		t.Fatalf("ApplyAdapter failed: %v", err)
 	}
@@ -108,6 +112,1654 @@ func TestApplyAdapter(t *testing.T) {
 	}
 }
 
+func TestApplyAdapter_MappingByTransport(t *testing.T) {
+	servers := map[string]ServerConfig{
+		"local": {
+			"name":      "local",
+			"transport": "stdio",
+			"command":   "node",
+		},
+		"remote": {
+			"name":      "remote",
+			"transport": "http",
+			"url":       "http://test",
+		},
+		"events": {
+			"name":      "events",
+			"transport": "sse",
+			"url":       "http://test/sse",
+		},
+	}
+
+	adapter := AdapterConfig{
+		Tool: "t1",
+		MappingByTransport: map[string]map[string]interface{}{
+			"stdio": {"command": "{{command}}"},
+			"http":  {"url": "{{url}}"},
+		},
+	}
+
+	adapter.Server = "local"
+	result, err := ApplyAdapter(adapter, servers, nil)
+	if err != nil {
+		t.Fatalf("ApplyAdapter failed for stdio server: %v", err)
+	}
+	if result["command"] != "node" || result["url"] != nil {
+		t.Errorf("Expected stdio mapping, got %v", result)
+	}
+
+	adapter.Server = "remote"
+	result, err = ApplyAdapter(adapter, servers, nil)
+	if err != nil {
+		t.Fatalf("ApplyAdapter failed for http server: %v", err)
+	}
+	if result["url"] != "http://test" || result["command"] != nil {
+		t.Errorf("Expected http mapping, got %v", result)
+	}
+
+	adapter.Server = "events"
+	_, err = ApplyAdapter(adapter, servers, nil)
+	if err == nil || !strings.Contains(err.Error(), "no mapping for transport 'sse'") {
+		t.Errorf("Expected missing transport mapping error, got %v", err)
+	}
+}
+
+func TestSubstitute_PlaceholderLanguage(t *testing.T) {
+	server := ServerConfig{
+		"name":    "s1",
+		"command": "/usr/local/bin/node",
+		"args":    []interface{}{"./tools/example.js", "--verbose"},
+		"env": map[string]interface{}{
+			"EXAMPLE_MODE": "demo",
+		},
+		"port": float64(3333),
+	}
+
+	tests := []struct {
+		template interface{}
+		expected interface{}
+	}{
+		{"{{env.EXAMPLE_MODE}}", "demo"},
+		{"{{ args[0] }}", "./tools/example.js"},
+		{"{{args}}", []interface{}{"./tools/example.js", "--verbose"}},
+		{"{{port}}", float64(3333)},
+		{`{{cwd | default "."}}`, "."},
+		{`{{name | default "."}}`, "s1"},
+		{`{{args | join " "}}`, "./tools/example.js --verbose"},
+		{"{{name | upper}}", "S1"},
+		{"{{command | basename}}", "node"},
+		{"{{env | json}}", `{"EXAMPLE_MODE":"demo"}`},
+		{`mode={{env.EXAMPLE_MODE | upper}} cmd={{command | basename}}`, "mode=DEMO cmd=node"},
+		{`{{args[1] | default "x" | upper}}`, "--VERBOSE"},
+		{`literal \{{name}} braces`, "literal {{name}} braces"},
+		{"{{cwd | optional}}", omitted},
+		{map[string]interface{}{"cwd": "{{cwd | optional}}", "cmd": "{{command | basename}}"}, map[string]interface{}{"cmd": "node"}},
+		{[]interface{}{"a", "{{cwd | optional}}"}, []interface{}{"a"}},
+	}
+
+	for _, tt := range tests {
+		result, err := substitute(tt.template, server, "mapping")
+		if err != nil {
+			t.Errorf("substitute(%v) failed: %v", tt.template, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("substitute(%v) = %#v, expected %#v", tt.template, result, tt.expected)
+		}
+	}
+
+	if _, err := substitute("{{name | shout}}", server, "mapping"); err == nil || !strings.Contains(err.Error(), "unknown filter 'shout'") {
+		t.Errorf("Expected unknown filter error, got %v", err)
+	}
+	if _, err := substitute("{{args | upper}}", server, "mapping"); err == nil {
+		t.Errorf("Expected error applying upper to a list")
+	}
+}
+
+func TestApplyAdapter_UnresolvedPlaceholder(t *testing.T) {
+	servers := map[string]ServerConfig{
+		"s1": {"name": "s1", "transport": "stdio", "command": "node"},
+	}
+
+	adapter := AdapterConfig{
+		Tool:   "t1",
+		Server: "s1",
+		Source: ".ai/mcp/adapters/t1.json",
+		Mapping: map[string]interface{}{
+			"nested": map[string]interface{}{
+				"args": []interface{}{"{{comand}}"},
+			},
+		},
+	}
+
+	_, err := ApplyAdapter(adapter, servers, nil)
+	if err == nil {
+		t.Fatal("Expected error for unresolved placeholder")
+	}
+	for _, want := range []string{".ai/mcp/adapters/t1.json", "mapping.nested.args[0]", "{{comand}}"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %q, got: %v", want, err)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	servers := map[string]ServerConfig{
+		"s1": {"name": "s1", "transport": "stdio", "command": "node"},
+	}
+
+	adapters := []AdapterConfig{
+		{Tool: "ok", Server: "s1", Mapping: map[string]interface{}{"command": "{{command}}"}},
+		{Tool: "typos", Server: "s1", Mapping: map[string]interface{}{"command": "{{comand}}", "args": "{{args}}"},
+			Overrides: map[string]map[string]interface{}{"zz": {}, "aa": {}}},
+		{Tool: "unknown", Server: "nope"},
+	}
+
+	problems := Lint(adapters, servers, nil)
+	if len(problems) != 5 {
+		t.Fatalf("Expected 5 problems, got %d: %v", len(problems), problems)
+	}
+
+	// The order is stable, so that CI can compare lint output.
+	want := []string{"unknown server 'aa'", "unknown server 'zz'", "mapping.args", "mapping.command", "'nope'"}
+	for run := 0; run < 10; run++ {
+		problems := Lint(adapters, servers, nil)
+		for i, fragment := range want {
+			if !strings.Contains(problems[i].Error(), fragment) {
+				t.Fatalf("Expected problem %d to mention %q, got %v", i, fragment, problems)
+			}
+		}
+	}
+}
+
+func TestLoadVars_Profile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	writeTestJson(t, filepath.Join(tmpDir, "vars.json"), map[string]interface{}{
+		"gitlab_host": "gitlab.com",
+		"ports":       map[string]interface{}{"http": 3333, "debug": 9229},
+	})
+	writeTestJson(t, filepath.Join(tmpDir, "vars.ci.json"), map[string]interface{}{
+		"gitlab_host": "gitlab.example.com",
+		"ports":       map[string]interface{}{"http": 8080},
+	})
+
+	vars, err := LoadVars(tmpDir, "")
+	if err != nil {
+		t.Fatalf("LoadVars failed: %v", err)
+	}
+	if vars["gitlab_host"] != "gitlab.com" {
+		t.Errorf("Expected base gitlab_host, got %v", vars["gitlab_host"])
+	}
+
+	vars, err = LoadVars(tmpDir, "ci")
+	if err != nil {
+		t.Fatalf("LoadVars with profile failed: %v", err)
+	}
+	if vars["gitlab_host"] != "gitlab.example.com" {
+		t.Errorf("Expected profile gitlab_host, got %v", vars["gitlab_host"])
+	}
+	ports := vars["ports"].(map[string]interface{})
+	if ports["http"] != float64(8080) || ports["debug"] != float64(9229) {
+		t.Errorf("Expected nested maps to be merged, got %v", ports)
+	}
+
+	if _, err := LoadVars(tmpDir, "missing"); err == nil {
+		t.Error("Expected error for missing profile file")
+	}
+	if _, err := LoadVars(filepath.Join(tmpDir, "nope"), ""); err != nil {
+		t.Errorf("Expected missing vars.json to be allowed, got %v", err)
+	}
+}
+
+func TestApplyAdapter_VarsAndBuiltins(t *testing.T) {
+	servers := map[string]ServerConfig{
+		"gitlab": {
+			"name":      "gitlab",
+			"transport": "http",
+			"url":       "https://{{vars.gitlab_host}}/api/v4/mcp",
+		},
+	}
+	globals := NewGlobals("/repo", map[string]interface{}{"gitlab_host": "gitlab.example.com"})
+
+	adapter := AdapterConfig{
+		Tool:   "t1",
+		Server: "gitlab",
+		Mapping: map[string]interface{}{
+			"url":  "{{url}}",
+			"host": "{{vars.gitlab_host}}",
+			"root": "{{repo_root}}",
+			"out":  "{{output_dir}}",
+			"os":   "{{os}}",
+		},
+	}
+
+	result, err := ApplyAdapter(adapter, servers, globals.WithOutputDir("/repo/.tool"))
+	if err != nil {
+		t.Fatalf("ApplyAdapter failed: %v", err)
+	}
+	if result["url"] != "https://gitlab.example.com/api/v4/mcp" {
+		t.Errorf("Expected vars in server definition to resolve, got %v", result["url"])
+	}
+	if result["host"] != "gitlab.example.com" || result["root"] != "/repo" || result["out"] != "/repo/.tool" {
+		t.Errorf("Unexpected globals in result: %v", result)
+	}
+	if result["os"] == "" {
+		t.Error("Expected os built-in to be set")
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	servers := map[string]ServerConfig{
+		"b_http": {"name": "b_http", "transport": "http", "url": "https://{{vars.host}}/mcp"},
+		"a_stdio": {
+			"name":      "a_stdio",
+			"transport": "stdio",
+			"command":   "node",
+			"args":      []interface{}{"a.js", "--flag"},
+		},
+	}
+	globals := NewGlobals(tmpDir, map[string]interface{}{"host": "example.com"})
+
+	tmpl := `{
+  "tool": {{json .tool}},
+  "servers": [
+{{- range $i, $s := .servers}}
+    {"id": {{json (upper $s.name)}}{{if eq $s.transport "stdio"}}, "cmd": {{json (printf "%s %s" $s.command (join " " $s.args))}}{{else}}, "url": {{json $s.url}}{{end}}}{{if not (last $i $.servers)}},{{end}}
+{{- end}}
+  ]
+}
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "list.json.tmpl"), []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	adapter := AdapterConfig{
+		Tool:     "lister",
+		Servers:  ServerSelection{"*"},
+		Template: "list.json.tmpl",
+		Source:   filepath.Join(tmpDir, "lister.json"),
+	}
+
+	content, err := RenderTemplate(adapter, servers, globals)
+	if err != nil {
+		t.Fatalf("RenderTemplate failed: %v", err)
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(content, &result); err != nil {
+		t.Fatalf("Rendered template is not JSON: %v\n%s", err, content)
+	}
+	expected := map[string]interface{}{
+		"tool": "lister",
+		"servers": []interface{}{
+			map[string]interface{}{"id": "A_STDIO", "cmd": "node a.js --flag"},
+			map[string]interface{}{"id": "B_HTTP", "url": "https://example.com/mcp"},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Unexpected template output:\n%s", content)
+	}
+
+	// Output that does not parse as the declared format is rejected
+	if err := os.WriteFile(filepath.Join(tmpDir, "broken.tmpl"), []byte("servers = [{{range .servers}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	adapter.Template = "broken.tmpl"
+	adapter.FormatType = "toml"
+	if _, err := RenderTemplate(adapter, servers, globals); err == nil {
+		t.Error("Expected error for template output that is not valid TOML")
+	}
+}
+
+func TestServerSelection_UnmarshalJSON(t *testing.T) {
+	var adapter AdapterConfig
+	if err := json.Unmarshal([]byte(`{"servers": "*"}`), &adapter); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(adapter.Servers, ServerSelection{"*"}) {
+		t.Errorf("Expected wildcard selection, got %v", adapter.Servers)
+	}
+
+	if err := json.Unmarshal([]byte(`{"servers": ["b", "a"]}`), &adapter); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	names, err := adapter.selectedServers(map[string]ServerConfig{"a": {}, "b": {}, "c": {}})
+	if err != nil {
+		t.Fatalf("selectedServers failed: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Errorf("Expected sorted selection, got %v", names)
+	}
+
+	if err := json.Unmarshal([]byte(`{"servers": 3}`), &adapter); err == nil {
+		t.Error("Expected error for invalid servers field")
+	}
+}
+
+func TestGenerateToolConfig_YAML(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), ".continue", "mcp.yaml")
+	config := map[string]interface{}{
+		"command": "node",
+		"args":    []interface{}{"./tools/example.js"},
+		"env":     map[string]interface{}{"B": "2", "A": "1"},
+	}
+
+	adapter := AdapterConfig{Tool: "continue", FormatType: "yaml", OutputPath: outputPath}
+	if _, err := GenerateToolConfig(adapter, []Entry{{Name: "continue", Config: config}}, nil); err != nil {
+		t.Fatalf("GenerateToolConfig failed: %v", err)
+	}
+
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	expected := `mcpServers:
+  continue:
+    args:
+      - ./tools/example.js
+    command: node
+    env:
+      A: "1"
+      B: "2"
+`
+	if string(content) != expected {
+		t.Errorf("Unexpected YAML output:\n%s\nExpected:\n%s", content, expected)
+	}
+
+	adapter.FormatType = "ini"
+	if _, err := GenerateToolConfig(adapter, nil, nil); err == nil || !strings.Contains(err.Error(), "unsupported format_type 'ini'") {
+		t.Errorf("Expected unsupported format error, got %v", err)
+	}
+}
+
+type upperFormat struct{}
+
+func (upperFormat) Encode(data interface{}) ([]byte, error) {
+	return []byte(strings.ToUpper(fmt.Sprint(data))), nil
+}
+
+func (upperFormat) Decode(content []byte) (interface{}, error) {
+	return string(content), nil
+}
+
+func TestRegisterFormat(t *testing.T) {
+	RegisterFormat("upper", upperFormat{})
+	defer delete(formats, "upper")
+
+	outputPath := filepath.Join(t.TempDir(), "out.txt")
+	adapter := AdapterConfig{Format: "servers", FormatType: "upper", OutputPath: outputPath}
+	if _, err := GenerateToolConfig(adapter, []Entry{{Name: "t", Config: map[string]interface{}{"k": "v"}}}, nil); err != nil {
+		t.Fatalf("GenerateToolConfig failed: %v", err)
+	}
+	content, _ := os.ReadFile(outputPath)
+	if string(content) != "MAP[SERVERS:MAP[T:MAP[K:V]]]" {
+		t.Errorf("Expected registered format to be used, got %s", content)
+	}
+}
+
+func TestBuildDocument_InsertPath(t *testing.T) {
+	entries := []Entry{
+		{Name: "a", Config: map[string]interface{}{"command": "node"}},
+		{Name: "b", Config: map[string]interface{}{"url": "http://b"}},
+	}
+
+	document, err := BuildDocument(entries, []string{"mcp", "servers"}, "")
+	if err != nil {
+		t.Fatalf("BuildDocument failed: %v", err)
+	}
+	expected := map[string]interface{}{
+		"mcp": map[string]interface{}{
+			"servers": map[string]interface{}{
+				"a": map[string]interface{}{"command": "node"},
+				"b": map[string]interface{}{"url": "http://b"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(document, expected) {
+		t.Errorf("Unexpected nested map document: %v", document)
+	}
+
+	document, err = BuildDocument(entries, []string{"amp.mcpServers"}, "array")
+	if err != nil {
+		t.Fatalf("BuildDocument failed: %v", err)
+	}
+	expected = map[string]interface{}{
+		"amp.mcpServers": []interface{}{
+			map[string]interface{}{"name": "a", "command": "node"},
+			map[string]interface{}{"name": "b", "url": "http://b"},
+		},
+	}
+	if !reflect.DeepEqual(document, expected) {
+		t.Errorf("Unexpected array document: %v", document)
+	}
+
+	if _, err := BuildDocument(entries, []string{"x"}, "set"); err == nil {
+		t.Error("Expected error for unsupported container")
+	}
+	if _, err := BuildDocument(append(entries, entries[0]), []string{"x"}, "map"); err == nil {
+		t.Error("Expected error for duplicate entry names")
+	}
+}
+
+func TestApplyAdapterEntries_MultipleServers(t *testing.T) {
+	servers := map[string]ServerConfig{
+		"b": {"name": "b", "transport": "http", "url": "http://b"},
+		"a": {"name": "a", "transport": "stdio", "command": "node"},
+	}
+	adapter := AdapterConfig{
+		Tool:    "zed",
+		Servers: ServerSelection{"*"},
+		MappingByTransport: map[string]map[string]interface{}{
+			"stdio": {"command": map[string]interface{}{"path": "{{command}}"}},
+			"http":  {"url": "{{url}}"},
+		},
+	}
+
+	entries, err := ApplyAdapterEntries(adapter, servers, nil)
+	if err != nil {
+		t.Fatalf("ApplyAdapterEntries failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Name != "a" || entries[1].Name != "b" {
+		t.Fatalf("Expected entries named after servers in order, got %v", entries)
+	}
+
+	adapter.Servers = nil
+	adapter.Server = "a"
+	entries, err = ApplyAdapterEntries(adapter, servers, nil)
+	if err != nil {
+		t.Fatalf("ApplyAdapterEntries failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "zed" {
+		t.Errorf("Expected single entry named after the tool, got %v", entries)
+	}
+}
+
+func TestLoadAdapters_VSCodePreset(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestJson(t, filepath.Join(tmpDir, "vscode.json"), map[string]interface{}{
+		"preset":  "vscode",
+		"servers": []string{"gitlab", "local"},
+	})
+
+	adapters, err := LoadAdapters(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadAdapters failed: %v", err)
+	}
+	if len(adapters) != 1 || adapters[0].Tool != "vscode" || adapters[0].OutputPath != ".vscode/mcp.json" {
+		t.Fatalf("Expected preset fields to be filled in, got %+v", adapters)
+	}
+
+	servers := map[string]ServerConfig{
+		"gitlab": {
+			"name":      "gitlab",
+			"transport": "http",
+			"url":       "https://gitlab.com/api/v4/mcp",
+			"headers":   map[string]interface{}{"Authorization": "Bearer ${GITLAB_TOKEN}"},
+		},
+		"local": {
+			"name":      "local",
+			"transport": "stdio",
+			"command":   "node",
+			"env":       map[string]interface{}{"GITLAB_TOKEN": "${GITLAB_TOKEN}", "MODE": "demo"},
+		},
+	}
+
+	globals := NewGlobals(tmpDir, nil)
+	entries, err := ApplyAdapterEntries(adapters[0], servers, globals)
+	if err != nil {
+		t.Fatalf("ApplyAdapterEntries failed: %v", err)
+	}
+	outputPath := filepath.Join(tmpDir, ".vscode", "mcp.json")
+	if _, err := GenerateToolConfig(adapters[0], entries, globals); err != nil {
+		t.Fatalf("GenerateToolConfig failed: %v", err)
+	}
+
+	var result map[string]interface{}
+	content, _ := os.ReadFile(outputPath)
+	if err := json.Unmarshal(content, &result); err != nil {
+		t.Fatalf("Invalid JSON output: %v", err)
+	}
+	expected := map[string]interface{}{
+		"inputs": []interface{}{
+			map[string]interface{}{
+				"type":        "promptString",
+				"id":          "gitlab-token",
+				"description": "GITLAB_TOKEN for MCP server 'gitlab'",
+				"password":    true,
+			},
+		},
+		"servers": map[string]interface{}{
+			"gitlab": map[string]interface{}{
+				"type":    "http",
+				"url":     "https://gitlab.com/api/v4/mcp",
+				"headers": map[string]interface{}{"Authorization": "Bearer ${input:gitlab-token}"},
+			},
+			"local": map[string]interface{}{
+				"type":    "stdio",
+				"command": "node",
+				"env":     map[string]interface{}{"GITLAB_TOKEN": "${input:gitlab-token}", "MODE": "demo"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Unexpected VS Code config:\n%s", content)
+	}
+
+	writeTestJson(t, filepath.Join(tmpDir, "vscode.json"), map[string]interface{}{"preset": "emacs"})
+	if _, err := LoadAdapters(tmpDir); err == nil || !strings.Contains(err.Error(), "unknown preset 'emacs'") {
+		t.Errorf("Expected unknown preset error, got %v", err)
+	}
+}
+
+func TestGenerateToolConfig_ZedMergesSettings(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestJson(t, filepath.Join(tmpDir, "zed.json"), map[string]interface{}{"preset": "zed"})
+
+	adapters, err := LoadAdapters(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadAdapters failed: %v", err)
+	}
+	adapter := adapters[0]
+
+	outputPath := filepath.Join(tmpDir, ".zed", "settings.json")
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	existing := `// Zed settings
+{
+  "theme": "One Dark", // keep me
+  "url_note": "http://not-a-comment",
+  /* hand-written servers are kept, generated ones replaced */
+  "context_servers": {
+    "manual": { "command": { "path": "manual" } },
+    "example_stdio": { "command": { "path": "stale" }, "settings": {} },
+  },
+}
+`
+	if err := os.WriteFile(outputPath, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	servers := map[string]ServerConfig{
+		"example_stdio": {
+			"name":      "example_stdio",
+			"transport": "stdio",
+			"command":   "node",
+			"args":      []interface{}{"./tools/example.js"},
+			"env":       map[string]interface{}{"EXAMPLE_MODE": "demo"},
+		},
+	}
+	globals := NewGlobals(tmpDir, nil)
+	entries, err := ApplyAdapterEntries(adapter, servers, globals)
+	if err != nil {
+		t.Fatalf("ApplyAdapterEntries failed: %v", err)
+	}
+	if _, err := GenerateToolConfig(adapter, entries, globals); err != nil {
+		t.Fatalf("GenerateToolConfig failed: %v", err)
+	}
+
+	var result map[string]interface{}
+	content, _ := os.ReadFile(outputPath)
+	if err := json.Unmarshal(stripJSONC(content), &result); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, content)
+	}
+	for _, kept := range []string{"// Zed settings\n", `"theme": "One Dark", // keep me`, "/* hand-written servers are kept", `"manual": { "command": { "path": "manual" } },`} {
+		if !strings.Contains(string(content), kept) {
+			t.Errorf("Expected %q to be kept:\n%s", kept, content)
+		}
+	}
+	expected := map[string]interface{}{
+		"theme":    "One Dark",
+		"url_note": "http://not-a-comment",
+		"context_servers": map[string]interface{}{
+			"manual": map[string]interface{}{
+				"command": map[string]interface{}{"path": "manual"},
+			},
+			"example_stdio": map[string]interface{}{
+				"command": map[string]interface{}{
+					"path": "node",
+					"args": []interface{}{"./tools/example.js"},
+					"env":  map[string]interface{}{"EXAMPLE_MODE": "demo"},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Unexpected merged settings:\n%s", content)
+	}
+}
+
+// TestGenerateToolConfig_MergeKeepsComments checks that merging into TOML
+// and YAML files rewrites only the generated entries, and that a file whose
+// comments cannot be kept is not rewritten.
+func TestGenerateToolConfig_MergeKeepsComments(t *testing.T) {
+	servers := map[string]ServerConfig{
+		"local": {"name": "local", "transport": "stdio", "command": "node", "args": []interface{}{"a.js"}},
+	}
+	tests := []struct {
+		preset   string
+		existing string
+		kept     []string
+		err      string
+	}{
+		{
+			preset: "codex",
+			existing: `# Codex settings
+model = "o3" # default model
+
+[mcp_servers.local]
+command = "stale"
+
+[mcp_servers.local.env]
+OLD = "1"
+
+# hand-written
+[mcp_servers.manual]
+command = "manual"
+`,
+			kept: []string{"# Codex settings\n", `model = "o3" # default model`, "# hand-written\n[mcp_servers.manual]\ncommand = \"manual\"\n"},
+		},
+		{
+			preset: "goose",
+			existing: `# Goose settings
+GOOSE_MODEL: gpt-4o # default model
+extensions:
+  # hand-written
+  manual:
+    name: manual
+    cmd: manual
+`,
+			kept: []string{"# Goose settings\n", "# default model", "# hand-written"},
+		},
+		{
+			preset: "codex",
+			existing: `# servers inline
+mcp_servers = { local = { command = "stale" } }
+`,
+			err: "without losing its comments",
+		},
+	}
+
+	for _, tt := range tests {
+		tmpDir := t.TempDir()
+		writeTestJson(t, filepath.Join(tmpDir, tt.preset+".json"), map[string]interface{}{"preset": tt.preset, "output_path": "{{repo_root}}/config"})
+		adapters, err := LoadAdapters(tmpDir)
+		if err != nil {
+			t.Fatalf("LoadAdapters failed: %v", err)
+		}
+		outputPath := filepath.Join(tmpDir, "config")
+		os.WriteFile(outputPath, []byte(tt.existing), 0644)
+
+		globals := NewGlobals(tmpDir, nil)
+		entries, err := ApplyAdapterEntries(adapters[0], servers, globals)
+		if err != nil {
+			t.Fatalf("ApplyAdapterEntries failed: %v", err)
+		}
+		_, err = GenerateToolConfig(adapters[0], entries, globals)
+		content, _ := os.ReadFile(outputPath)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) || string(content) != tt.existing {
+				t.Errorf("%s: expected %q and the file unchanged, got %v:\n%s", tt.preset, tt.err, err, content)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: GenerateToolConfig failed: %v", tt.preset, err)
+		}
+		for _, kept := range tt.kept {
+			if !strings.Contains(string(content), kept) {
+				t.Errorf("%s: expected %q to be kept:\n%s", tt.preset, kept, content)
+			}
+		}
+		format, _ := LookupFormat(adapters[0].FormatType)
+		parsed, err := format.Decode(content)
+		if err != nil {
+			t.Fatalf("%s: invalid output: %v\n%s", tt.preset, err, content)
+		}
+		collection := parsed.(map[string]interface{})[adapters[0].insertPath()[0]].(map[string]interface{})
+		local, _ := collection["local"].(map[string]interface{})
+		if local["command"] != "node" && local["cmd"] != "node" || collection["manual"] == nil || strings.Contains(string(content), "OLD") {
+			t.Errorf("%s: expected local to be replaced and manual kept:\n%s", tt.preset, content)
+		}
+	}
+}
+
+func TestGenerateToolConfig_ContinuePerServerFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestJson(t, filepath.Join(tmpDir, "continue.json"), map[string]interface{}{"preset": "continue"})
+
+	adapters, err := LoadAdapters(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadAdapters failed: %v", err)
+	}
+
+	servers := map[string]ServerConfig{
+		"local":  {"name": "local", "transport": "stdio", "command": "node", "args": []interface{}{"a.js"}},
+		"remote": {"name": "remote", "transport": "http", "url": "http://remote/mcp"},
+	}
+	globals := NewGlobals(tmpDir, nil)
+	entries, err := ApplyAdapterEntries(adapters[0], servers, globals)
+	if err != nil {
+		t.Fatalf("ApplyAdapterEntries failed: %v", err)
+	}
+	written, err := GenerateToolConfig(adapters[0], entries, globals)
+	if err != nil {
+		t.Fatalf("GenerateToolConfig failed: %v", err)
+	}
+
+	expectedFiles := map[string]string{
+		filepath.Join(tmpDir, ".continue", "mcpServers", "local.yaml"): `mcpServers:
+  - args:
+      - a.js
+    command: node
+    name: local
+    type: stdio
+name: local
+schema: v1
+version: 0.0.1
+`,
+		filepath.Join(tmpDir, ".continue", "mcpServers", "remote.yaml"): `mcpServers:
+  - name: remote
+    type: streamable-http
+    url: http://remote/mcp
+name: remote
+schema: v1
+version: 0.0.1
+`,
+	}
+	if len(written) != len(expectedFiles) {
+		t.Fatalf("Expected %d files, got %v", len(expectedFiles), written)
+	}
+	for path, expected := range expectedFiles {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("Expected file %s: %v", path, err)
+			continue
+		}
+		if string(content) != expected {
+			t.Errorf("Unexpected content in %s:\n%s", path, content)
+		}
+	}
+}
+
+func TestGenerateToolConfig_GooseMergesExtensions(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestJson(t, filepath.Join(tmpDir, "goose.json"), map[string]interface{}{
+		"preset":      "goose",
+		"output_path": "config.yaml",
+	})
+	adapters, err := LoadAdapters(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadAdapters failed: %v", err)
+	}
+
+	existing := `GOOSE_PROVIDER: anthropic
+extensions:
+  developer:
+    bundled: true
+    enabled: true
+    name: developer
+    type: builtin
+`
+	outputPath := filepath.Join(tmpDir, "config.yaml")
+	if err := os.WriteFile(outputPath, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	servers := map[string]ServerConfig{
+		"remote": {"name": "remote", "transport": "http", "url": "http://remote/mcp"},
+	}
+	globals := NewGlobals(tmpDir, nil)
+	entries, err := ApplyAdapterEntries(adapters[0], servers, globals)
+	if err != nil {
+		t.Fatalf("ApplyAdapterEntries failed: %v", err)
+	}
+	if _, err := GenerateToolConfig(adapters[0], entries, globals); err != nil {
+		t.Fatalf("GenerateToolConfig failed: %v", err)
+	}
+
+	content, _ := os.ReadFile(outputPath)
+	expected := `GOOSE_PROVIDER: anthropic
+extensions:
+  developer:
+    bundled: true
+    enabled: true
+    name: developer
+    type: builtin
+  remote:
+    enabled: true
+    name: remote
+    timeout: 300
+    type: streamable_http
+    uri: http://remote/mcp
+`
+	if string(content) != expected {
+		t.Errorf("Unexpected Goose config:\n%s", content)
+	}
+}
+
+func TestPresetLibrary(t *testing.T) {
+	presets, err := ListPresets()
+	if err != nil {
+		t.Fatalf("ListPresets failed: %v", err)
+	}
+
+	expected := []string{"claude", "claude-settings", "codex", "continue", "cursor", "gemini", "gitlab-duo", "goose", "vscode", "windsurf", "zed"}
+	var names []string
+	for _, preset := range presets {
+		names = append(names, preset.Name)
+		if preset.Version < 1 || preset.OutputPath == "" || preset.Description == "" {
+			t.Errorf("Preset %s is missing version, output path or description: %+v", preset.Name, preset)
+		}
+		if raw, _ := loadPreset(preset.Name); raw["transports"] == nil {
+			t.Errorf("Preset %s does not declare its transports", preset.Name)
+		}
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected presets %v, got %v", expected, names)
+	}
+
+	servers := map[string]ServerConfig{
+		"local":  {"name": "local", "transport": "stdio", "command": "node"},
+		"remote": {"name": "remote", "transport": "http", "url": "http://remote/mcp"},
+	}
+
+	// Every preset works from a one-line adapter file
+	tmpDir := t.TempDir()
+	for _, preset := range presets {
+		writeTestJson(t, filepath.Join(tmpDir, preset.Name+".json"), map[string]interface{}{
+			"preset": fmt.Sprintf("%s@%d", preset.Name, preset.Version),
+		})
+	}
+	adapters, err := LoadAdapters(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadAdapters failed: %v", err)
+	}
+	if problems := Lint(adapters, servers, NewGlobals(tmpDir, nil)); len(problems) > 0 {
+		t.Errorf("Presets have lint problems: %v", problems)
+	}
+
+	// Overrides in the adapter file win over the preset
+	writeTestJson(t, filepath.Join(tmpDir, "cursor.json"), map[string]interface{}{
+		"preset":      "cursor",
+		"servers":     []string{"local"},
+		"output_path": "custom/mcp.json",
+	})
+	adapters, err = LoadAdapters(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadAdapters failed: %v", err)
+	}
+	for _, adapter := range adapters {
+		if adapter.Tool == "cursor" && (adapter.OutputPath != "custom/mcp.json" || !reflect.DeepEqual(adapter.Servers, ServerSelection{"local"})) {
+			t.Errorf("Expected overrides to apply, got %+v", adapter)
+		}
+	}
+
+	writeTestJson(t, filepath.Join(tmpDir, "cursor.json"), map[string]interface{}{"preset": "cursor@99"})
+	if _, err := LoadAdapters(tmpDir); err == nil || !strings.Contains(err.Error(), "pins version 99") {
+		t.Errorf("Expected version pin error, got %v", err)
+	}
+}
+
+// TestPresetLibrary_UnsupportedTransport checks that the built-in codex
+// preset, which cannot launch sse servers, wraps them in mcp-bridge proxy.
+func TestPresetLibrary_UnsupportedTransport(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestJson(t, filepath.Join(tmpDir, "codex.json"), map[string]interface{}{"preset": "codex"})
+	adapters, err := LoadAdapters(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadAdapters failed: %v", err)
+	}
+	servers := map[string]ServerConfig{
+		"legacy": {"name": "legacy", "transport": "sse", "url": "https://legacy/sse"},
+	}
+	entries, err := ApplyAdapterEntries(adapters[0], servers, NewGlobals(tmpDir, nil))
+	if err != nil {
+		t.Fatalf("ApplyAdapterEntries failed: %v", err)
+	}
+	expected := map[string]interface{}{
+		"command": "mcp-bridge",
+		"args":    []interface{}{"proxy", "--url", "https://legacy/sse", "--transport", "sse"},
+	}
+	if !reflect.DeepEqual(entries[0].Config, expected) {
+		t.Errorf("Expected the sse server behind mcp-bridge proxy, got %v", entries[0].Config)
+	}
+}
+
+// TestPresetLibrary_AdapterFieldsWin checks that an adapter's 'server' and
+// 'mapping' replace the preset's 'servers' and 'mapping_by_transport'.
+func TestPresetLibrary_AdapterFieldsWin(t *testing.T) {
+	servers := map[string]ServerConfig{
+		"local":  {"name": "local", "transport": "stdio", "command": "node"},
+		"other":  {"name": "other", "transport": "stdio", "command": "python"},
+		"remote": {"name": "remote", "transport": "http", "url": "http://remote/mcp"},
+	}
+	tmpDir := t.TempDir()
+	writeTestJson(t, filepath.Join(tmpDir, "zed.json"), map[string]interface{}{"preset": "zed", "server": "local"})
+	writeTestJson(t, filepath.Join(tmpDir, "cursor.json"), map[string]interface{}{
+		"preset":  "cursor",
+		"mapping": map[string]interface{}{"command": "wrapped", "args": []interface{}{"{{name}}"}},
+	})
+	adapters, err := LoadAdapters(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadAdapters failed: %v", err)
+	}
+	for _, adapter := range adapters {
+		entries, err := ApplyAdapterEntries(adapter, servers, NewGlobals(tmpDir, nil))
+		if err != nil {
+			t.Fatalf("ApplyAdapterEntries failed for %s: %v", adapter.Tool, err)
+		}
+		switch adapter.Tool {
+		case "zed":
+			if len(entries) != 1 || entries[0].Server["name"] != "local" {
+				t.Errorf("Expected only the adapter's server, got %v", entries)
+			}
+		case "cursor":
+			if len(entries) != 3 || entries[0].Config["command"] != "wrapped" {
+				t.Errorf("Expected the adapter's mapping, got %v", entries)
+			}
+		}
+	}
+}
+
+func TestGenerateToolConfig_CodexFields(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestJson(t, filepath.Join(tmpDir, "codex.json"), map[string]interface{}{"preset": "codex"})
+	adapters, err := LoadAdapters(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadAdapters failed: %v", err)
+	}
+
+	serversDir := filepath.Join(tmpDir, "servers")
+	if err := os.MkdirAll(serversDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestJson(t, filepath.Join(serversDir, "local.json"), map[string]interface{}{
+		"name":      "local",
+		"transport": "stdio",
+		"command":   "node",
+		"args":      []string{"./tools/example.js"},
+		"env":       map[string]string{"EXAMPLE_MODE": "demo", "API_URL": "http://localhost"},
+		"cwd":       "{{repo_root}}/tools",
+		"enabled":   false,
+		"timeouts":  map[string]interface{}{"startup_ms": 20000, "tool_call_ms": 1500},
+		"tools":     map[string]interface{}{"include": []string{"search", "read"}, "exclude": []string{"delete"}},
+	})
+	writeTestJson(t, filepath.Join(serversDir, "remote.json"), map[string]interface{}{
+		"name":      "remote",
+		"transport": "http",
+		"url":       "https://remote/mcp",
+	})
+	servers, err := LoadServers(serversDir)
+	if err != nil {
+		t.Fatalf("LoadServers failed: %v", err)
+	}
+
+	globals := NewGlobals("/repo", nil)
+	adapters[0].OutputPath = filepath.Join(tmpDir, "config.toml")
+	entries, err := ApplyAdapterEntries(adapters[0], servers, globals)
+	if err != nil {
+		t.Fatalf("ApplyAdapterEntries failed: %v", err)
+	}
+	if _, err := GenerateToolConfig(adapters[0], entries, globals); err != nil {
+		t.Fatalf("GenerateToolConfig failed: %v", err)
+	}
+
+	content, _ := os.ReadFile(adapters[0].OutputPath)
+	expected := `[mcp_servers]
+[mcp_servers.local]
+args = ['./tools/example.js']
+command = 'node'
+cwd = '/repo/tools'
+disabled_tools = ['delete']
+enabled = false
+enabled_tools = ['search', 'read']
+startup_timeout_sec = 20
+tool_timeout_sec = 1.5
+
+[mcp_servers.local.env]
+API_URL = 'http://localhost'
+EXAMPLE_MODE = 'demo'
+
+[mcp_servers.remote]
+url = 'https://remote/mcp'
+`
+	if string(content) != expected {
+		t.Errorf("Unexpected Codex config:\n%s\nExpected:\n%s", content, expected)
+	}
+}
+
+func TestLoadServers_InvalidCanonicalFields(t *testing.T) {
+	tests := []struct {
+		field string
+		value interface{}
+		err   string
+	}{
+		{"cwd", 3, "'cwd' must be a string"},
+		{"enabled", "yes", "'enabled' must be true or false"},
+		{"timeouts", map[string]interface{}{"startup_ms": -1}, "'timeouts.startup_ms' must be a positive number"},
+		{"timeouts", map[string]interface{}{"startup": 10}, "unknown field 'timeouts.startup'"},
+		{"tools", map[string]interface{}{"include": "search"}, "'tools.include' must be a list"},
+		{"tool_prefix", true, "'tool_prefix' must be a string"},
+		{"tool_aliases", map[string]interface{}{"search": ""}, "'tool_aliases.search' must be a non-empty string"},
+		{"tool_aliases", map[string]interface{}{"find": "lookup", "search": "lookup"}, "tools 'find' and 'search' are both aliased to 'lookup'"},
+	}
+
+	for _, tt := range tests {
+		tmpDir := t.TempDir()
+		writeTestJson(t, filepath.Join(tmpDir, "s.json"), map[string]interface{}{
+			"name":      "s",
+			"transport": "stdio",
+			"command":   "node",
+			tt.field:    tt.value,
+		})
+		if _, err := LoadServers(tmpDir); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Expected error containing %q for %s, got %v", tt.err, tt.field, err)
+		}
+	}
+}
+
+func TestWarnings_Timeouts(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"claude", "codex", "gemini"} {
+		writeTestJson(t, filepath.Join(tmpDir, name+".json"), map[string]interface{}{"preset": name})
+	}
+	adapters, err := LoadAdapters(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadAdapters failed: %v", err)
+	}
+
+	servers := map[string]ServerConfig{
+		"slow": {
+			"name":      "slow",
+			"transport": "stdio",
+			"command":   "node",
+			"timeouts":  map[string]interface{}{"startup_ms": float64(20000), "tool_call_ms": float64(90000)},
+		},
+		"fast": {"name": "fast", "transport": "http", "url": "https://fast/mcp"},
+	}
+	globals := NewGlobals("/repo", nil)
+
+	expected := map[string][]string{
+		"claude": {"server 'slow' sets 'timeouts.startup_ms'", "server 'slow' sets 'timeouts.tool_call_ms'"},
+		"codex":  nil,
+		"gemini": {"server 'slow' sets 'timeouts.startup_ms'"},
+	}
+	for _, adapter := range adapters {
+		warnings, err := Warnings(adapter, servers, globals)
+		if err != nil {
+			t.Fatalf("Warnings failed for %s: %v", adapter.Tool, err)
+		}
+		want := expected[adapter.Tool]
+		if len(warnings) != len(want) {
+			t.Errorf("Expected %d warning(s) for %s, got %v", len(want), adapter.Tool, warnings)
+			continue
+		}
+		for i, w := range want {
+			if !strings.Contains(warnings[i], w) {
+				t.Errorf("Expected warning for %s to contain %q, got %q", adapter.Tool, w, warnings[i])
+			}
+		}
+	}
+
+	for _, adapter := range adapters {
+		if adapter.Tool != "gemini" {
+			continue
+		}
+		entries, err := ApplyAdapterEntries(adapter, servers, globals)
+		if err != nil {
+			t.Fatalf("ApplyAdapterEntries failed: %v", err)
+		}
+		if entries[1].Name != "slow" || entries[1].Config["timeout"] != float64(90000) {
+			t.Errorf("Expected gemini timeout for 'slow', got %v", entries[1])
+		}
+	}
+}
+
+func TestApplyAdapterEntries_ToolFilterOverrides(t *testing.T) {
+	servers := map[string]ServerConfig{
+		"gitlab": {
+			"name":      "gitlab",
+			"transport": "http",
+			"url":       "https://gitlab/mcp",
+			"tools":     map[string]interface{}{"exclude": []interface{}{"delete_project"}},
+		},
+		"local": {"name": "local", "transport": "stdio", "command": "node"},
+	}
+	globals := NewGlobals("/repo", nil)
+
+	tmpDir := t.TempDir()
+	writeTestJson(t, filepath.Join(tmpDir, "gemini.json"), map[string]interface{}{
+		"preset": "gemini",
+		"overrides": map[string]interface{}{
+			"gitlab": map[string]interface{}{
+				"tools": map[string]interface{}{"include": []string{"get_issue", "list_issues"}},
+			},
+		},
+	})
+	writeTestJson(t, filepath.Join(tmpDir, "cursor.json"), map[string]interface{}{
+		"preset":    "cursor",
+		"overrides": map[string]interface{}{"missing": map[string]interface{}{"enabled": false}},
+	})
+	adapters, err := LoadAdapters(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadAdapters failed: %v", err)
+	}
+	cursor, gemini := adapters[0], adapters[1]
+
+	entries, err := ApplyAdapterEntries(gemini, servers, globals)
+	if err != nil {
+		t.Fatalf("ApplyAdapterEntries failed: %v", err)
+	}
+	config := entries[0].Config
+	if !reflect.DeepEqual(config["includeTools"], []interface{}{"get_issue", "list_issues"}) {
+		t.Errorf("Expected overridden includeTools, got %v", config["includeTools"])
+	}
+	if !reflect.DeepEqual(config["excludeTools"], []interface{}{"delete_project"}) {
+		t.Errorf("Expected excludeTools kept from the server, got %v", config["excludeTools"])
+	}
+	if _, ok := entries[1].Config["includeTools"]; ok {
+		t.Errorf("Expected no includeTools for 'local', got %v", entries[1].Config)
+	}
+
+	warnings, err := Warnings(cursor, servers, globals)
+	if err != nil {
+		t.Fatalf("Warnings failed: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "server 'gitlab' sets 'tools.exclude'") {
+		t.Errorf("Expected a tools.exclude warning for cursor, got %v", warnings)
+	}
+
+	problems := Lint([]AdapterConfig{cursor}, servers, globals)
+	if len(problems) != 1 || !strings.Contains(problems[0].Error(), "overrides unknown server 'missing'") {
+		t.Errorf("Expected unknown override to be reported, got %v", problems)
+	}
+
+	gemini.Overrides = map[string]map[string]interface{}{"*": {"tools": map[string]interface{}{"include": "all"}}}
+	if _, err := ApplyAdapterEntries(gemini, servers, globals); err == nil || !strings.Contains(err.Error(), "'tools.include' must be a list") {
+		t.Errorf("Expected invalid override to fail, got %v", err)
+	}
+}
+
+func TestApplyAdapterEntries_OAuth(t *testing.T) {
+	servers := map[string]ServerConfig{
+		"gitlab": {
+			"name":      "gitlab",
+			"transport": "http",
+			"url":       "https://gitlab/api/v4/mcp",
+			"auth": map[string]interface{}{
+				"type":      "oauth",
+				"client_id": "abc",
+				"scopes":    []interface{}{"mcp", "read_api"},
+			},
+		},
+	}
+	globals := NewGlobals("/repo", nil)
+
+	tmpDir := t.TempDir()
+	names := []string{"claude", "cursor", "gemini", "gitlab-duo", "vscode", "windsurf"}
+	for _, name := range names {
+		writeTestJson(t, filepath.Join(tmpDir, name+".json"), map[string]interface{}{"preset": name})
+	}
+	adapters, err := LoadAdapters(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadAdapters failed: %v", err)
+	}
+
+	generated := func(adapter AdapterConfig) interface{} {
+		adapter.OutputPath = filepath.Join(tmpDir, adapter.Tool+".out.json")
+		entries, err := ApplyAdapterEntries(adapter, servers, globals)
+		if err != nil {
+			t.Fatalf("ApplyAdapterEntries failed for %s: %v", adapter.Tool, err)
+		}
+		if _, err := GenerateToolConfig(adapter, entries, globals); err != nil {
+			t.Fatalf("GenerateToolConfig failed for %s: %v", adapter.Tool, err)
+		}
+		content, _ := os.ReadFile(adapter.OutputPath)
+		var document map[string]interface{}
+		if err := json.Unmarshal(content, &document); err != nil {
+			t.Fatalf("Invalid output for %s: %v", adapter.Tool, err)
+		}
+		servers, _ := document[adapter.InsertPath[0]].(map[string]interface{})
+		return servers["gitlab"]
+	}
+
+	scopes := []interface{}{"mcp", "read_api"}
+	expected := map[string]interface{}{
+		"claude": map[string]interface{}{
+			"type":  "http",
+			"url":   "https://gitlab/api/v4/mcp",
+			"oauth": map[string]interface{}{"clientId": "abc"},
+		},
+		"cursor": map[string]interface{}{
+			"url":  "https://gitlab/api/v4/mcp",
+			"auth": map[string]interface{}{"CLIENT_ID": "abc", "scopes": scopes},
+		},
+		"gemini": map[string]interface{}{
+			"httpUrl": "https://gitlab/api/v4/mcp",
+			"oauth":   map[string]interface{}{"enabled": true, "clientId": "abc", "scopes": scopes},
+		},
+		"gitlab-duo-cli": map[string]interface{}{
+			"type":    "stdio",
+			"command": "npx",
+			"args": []interface{}{
+				"-y", "mcp-remote", "https://gitlab/api/v4/mcp", "--transport", "http-only",
+				"--static-oauth-client-info", `{"client_id":"abc"}`,
+				"--static-oauth-client-metadata", `{"scope":"mcp read_api"}`,
+			},
+		},
+		"vscode":   map[string]interface{}{"type": "http", "url": "https://gitlab/api/v4/mcp"},
+		"windsurf": map[string]interface{}{"serverUrl": "https://gitlab/api/v4/mcp"},
+	}
+	for _, adapter := range adapters {
+		if server := generated(adapter); !reflect.DeepEqual(server, expected[adapter.Tool]) {
+			t.Errorf("Unexpected OAuth config for %s: %v", adapter.Tool, server)
+		}
+		warnings, err := Warnings(adapter, servers, globals)
+		if err != nil {
+			t.Fatalf("Warnings failed: %v", err)
+		}
+		if adapter.Tool == "gitlab-duo-cli" {
+			if len(warnings) != 1 || !strings.Contains(warnings[0], "launched through mcp-remote") {
+				t.Errorf("Expected the wrapper to be reported, got %v", warnings)
+			}
+		} else if len(warnings) != 0 {
+			t.Errorf("Expected no warnings for %s, got %v", adapter.Tool, warnings)
+		}
+	}
+}
+
+func TestLoadServers_InvalidAuth(t *testing.T) {
+	tests := []struct {
+		config map[string]interface{}
+		err    string
+	}{
+		{map[string]interface{}{"transport": "stdio", "command": "node", "auth": map[string]interface{}{"type": "oauth"}}, "'auth' requires an http or sse transport"},
+		{map[string]interface{}{"auth": map[string]interface{}{"type": "basic"}}, "unsupported 'auth.type'"},
+		{map[string]interface{}{"auth": map[string]interface{}{"type": "oauth", "scopes": "mcp"}}, "'auth.scopes' must be a list"},
+		{map[string]interface{}{"auth": map[string]interface{}{"type": "oauth", "token_url": "not a url"}}, "'auth.token_url' must be an http(s) URL"},
+		{map[string]interface{}{"auth": map[string]interface{}{"type": "oauth", "audience": "x"}}, "unknown field 'auth.audience'"},
+	}
+
+	for _, tt := range tests {
+		tmpDir := t.TempDir()
+		config := map[string]interface{}{"name": "s", "transport": "http", "url": "https://s/mcp"}
+		for k, v := range tt.config {
+			config[k] = v
+		}
+		writeTestJson(t, filepath.Join(tmpDir, "s.json"), config)
+		if _, err := LoadServers(tmpDir); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Expected error containing %q, got %v", tt.err, err)
+		}
+	}
+}
+
+func TestApplyAdapterEntries_Approval(t *testing.T) {
+	servers := map[string]ServerConfig{
+		"gitlab": {
+			"name":      "gitlab",
+			"transport": "http",
+			"url":       "https://gitlab/mcp",
+			"approval":  map[string]interface{}{"trusted": false, "auto_approve_tools": []interface{}{"get_issue"}},
+		},
+	}
+	globals := NewGlobals("/repo", nil)
+
+	tmpDir := t.TempDir()
+	writeTestJson(t, filepath.Join(tmpDir, "gemini.json"), map[string]interface{}{
+		"preset":    "gemini",
+		"overrides": map[string]interface{}{"*": map[string]interface{}{"approval": map[string]interface{}{"trusted": true}}},
+	})
+	writeTestJson(t, filepath.Join(tmpDir, "zed.json"), map[string]interface{}{"preset": "zed"})
+	adapters, err := LoadAdapters(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadAdapters failed: %v", err)
+	}
+	gemini, zed := adapters[0], adapters[1]
+
+	entries, err := ApplyAdapterEntries(gemini, servers, globals)
+	if err != nil {
+		t.Fatalf("ApplyAdapterEntries failed: %v", err)
+	}
+	if entries[0].Config["trust"] != true {
+		t.Errorf("Expected overridden trust for gemini, got %v", entries[0].Config)
+	}
+	warnings, _ := Warnings(gemini, servers, globals)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "'approval.auto_approve_tools'") {
+		t.Errorf("Expected an auto_approve_tools warning for gemini, got %v", warnings)
+	}
+
+	// trusted: false is the default and is not reported.
+	warnings, _ = Warnings(zed, servers, globals)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "'approval.auto_approve_tools'") {
+		t.Errorf("Expected only an auto_approve_tools warning for zed, got %v", warnings)
+	}
+
+	// No client can be told to always ask, so every one of them warns.
+	servers["gitlab"]["approval"] = map[string]interface{}{"always_ask": true}
+	gemini.Overrides = nil
+	for _, adapter := range []AdapterConfig{gemini, zed} {
+		warnings, _ = Warnings(adapter, servers, globals)
+		if len(warnings) != 1 || !strings.Contains(warnings[0], "'approval.always_ask'") {
+			t.Errorf("Expected an always_ask warning for %s, got %v", adapter.Tool, warnings)
+		}
+	}
+
+	tmpDir = t.TempDir()
+	writeTestJson(t, filepath.Join(tmpDir, "s.json"), map[string]interface{}{
+		"name":      "s",
+		"transport": "stdio",
+		"command":   "node",
+		"approval":  map[string]interface{}{"always_ask": true, "trusted": true},
+	})
+	if _, err := LoadServers(tmpDir); err == nil || !strings.Contains(err.Error(), "'approval.always_ask' conflicts") {
+		t.Errorf("Expected conflicting approval to fail, got %v", err)
+	}
+}
+
+// TestGenerateToolConfig_ClaudeSettings checks that approvals become Claude
+// Code permission rules, replacing only the rules of generated servers.
+func TestGenerateToolConfig_ClaudeSettings(t *testing.T) {
+	servers := map[string]ServerConfig{
+		"docs":   {"name": "docs", "transport": "stdio", "command": "docs", "approval": map[string]interface{}{"trusted": true}},
+		"gitlab": {"name": "gitlab", "transport": "http", "url": "https://gitlab/mcp", "approval": map[string]interface{}{"auto_approve_tools": []interface{}{"get_issue"}}},
+		"shell":  {"name": "shell", "transport": "stdio", "command": "sh", "approval": map[string]interface{}{"always_ask": true}},
+	}
+	tmpDir := t.TempDir()
+	globals := NewGlobals(tmpDir, nil)
+	os.MkdirAll(filepath.Join(tmpDir, "adapters"), 0o755)
+	os.MkdirAll(filepath.Join(tmpDir, ".claude"), 0o755)
+	writeTestJson(t, filepath.Join(tmpDir, "adapters", "claude.json"), map[string]interface{}{"preset": "claude"})
+	writeTestJson(t, filepath.Join(tmpDir, "adapters", "claude-settings.json"), map[string]interface{}{"preset": "claude-settings"})
+	writeTestJson(t, filepath.Join(tmpDir, ".claude", "settings.json"), map[string]interface{}{
+		"model": "opus",
+		"permissions": map[string]interface{}{
+			"allow": []interface{}{"Bash(npm test)", "mcp__gitlab__old_tool", "mcp__manual__search"},
+			"deny":  []interface{}{"mcp__gitlab__delete_project"},
+		},
+	})
+	adapters, err := LoadAdapters(filepath.Join(tmpDir, "adapters"))
+	if err != nil {
+		t.Fatalf("LoadAdapters failed: %v", err)
+	}
+	settings, claude := adapters[0], adapters[1]
+
+	entries, err := ApplyAdapterEntries(settings, servers, globals)
+	if err != nil {
+		t.Fatalf("ApplyAdapterEntries failed: %v", err)
+	}
+	if _, err := GenerateToolConfig(settings, entries, globals); err != nil {
+		t.Fatalf("GenerateToolConfig failed: %v", err)
+	}
+	content, _ := os.ReadFile(filepath.Join(tmpDir, ".claude", "settings.json"))
+	var written map[string]interface{}
+	if err := json.Unmarshal(content, &written); err != nil {
+		t.Fatalf("Invalid settings: %v", err)
+	}
+	expected := map[string]interface{}{
+		"model": "opus",
+		"permissions": map[string]interface{}{
+			"allow": []interface{}{"Bash(npm test)", "mcp__manual__search", "mcp__docs", "mcp__gitlab__get_issue"},
+			"ask":   []interface{}{"mcp__shell"},
+			"deny":  []interface{}{"mcp__gitlab__delete_project"},
+		},
+	}
+	if !reflect.DeepEqual(written, expected) {
+		t.Errorf("Expected %v, got %v", expected, written)
+	}
+	if warnings, _ := Warnings(settings, servers, globals); len(warnings) != 0 {
+		t.Errorf("Expected no warnings for claude-settings, got %v", warnings)
+	}
+
+	warnings, _ := Warnings(claude, servers, globals)
+	if len(warnings) != 3 {
+		t.Fatalf("Expected one approval warning per server for claude, got %v", warnings)
+	}
+	for _, warning := range warnings {
+		if !strings.Contains(warning, "'claude-settings' preset") {
+			t.Errorf("Expected the warning to point to claude-settings, got %q", warning)
+		}
+	}
+}
+
+// TestApplyAdapterEntries_EscapedPlaceholder checks that server fields are
+// expanded once, so escaped braces reach the output as literal braces.
+func TestApplyAdapterEntries_EscapedPlaceholder(t *testing.T) {
+	servers := map[string]ServerConfig{
+		"s": {"name": "s", "transport": "stdio", "command": "node", "env": map[string]interface{}{"X": `\{{literal}}`}},
+	}
+	adapter := AdapterConfig{
+		Tool:    "client",
+		Servers: ServerSelection{"*"},
+		Mapping: map[string]interface{}{"command": "{{command}}", "env": "{{env}}"},
+	}
+	entries, err := ApplyAdapterEntries(adapter, servers, NewGlobals("/repo", nil))
+	if err != nil {
+		t.Fatalf("ApplyAdapterEntries failed: %v", err)
+	}
+	env, _ := entries[0].Config["env"].(map[string]interface{})
+	if env["X"] != "{{literal}}" {
+		t.Errorf("Expected literal braces, got %v", entries[0].Config)
+	}
+}
+
+func TestApplyAdapterEntries_StdioOnlyClient(t *testing.T) {
+	servers := map[string]ServerConfig{
+		"local": {"name": "local", "transport": "stdio", "command": "node"},
+		"remote": {
+			"name":      "remote",
+			"transport": "sse",
+			"url":       "https://remote/sse",
+			"headers":   map[string]interface{}{"X-Team": "ai", "Authorization": "Bearer ${TOKEN}"},
+		},
+	}
+	globals := NewGlobals("/repo", nil)
+
+	adapter := AdapterConfig{
+		Tool:       "legacy",
+		Servers:    ServerSelection{"*"},
+		Transports: []string{"stdio"},
+		Mapping:    map[string]interface{}{"command": "{{command}}", "args": "{{args | optional}}"},
+	}
+	entries, err := ApplyAdapterEntries(adapter, servers, globals)
+	if err != nil {
+		t.Fatalf("ApplyAdapterEntries failed: %v", err)
+	}
+	expected := map[string]interface{}{
+		"command": "mcp-bridge",
+		"args": []interface{}{
+			"proxy", "--url", "https://remote/sse", "--transport", "sse",
+			"--header", "Authorization:Bearer ${TOKEN}", "--header", "X-Team:ai",
+		},
+	}
+	if !reflect.DeepEqual(entries[1].Config, expected) {
+		t.Errorf("Expected proxied remote server, got %v", entries[1].Config)
+	}
+	if entries[0].Config["command"] != "node" {
+		t.Errorf("Expected stdio server unchanged, got %v", entries[0].Config)
+	}
+
+	warnings, err := Warnings(adapter, servers, globals)
+	if err != nil {
+		t.Fatalf("Warnings failed: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "server 'remote' uses transport 'sse', which legacy does not support; it is launched through mcp-bridge proxy") {
+		t.Errorf("Expected the rewrite to be reported, got %v", warnings)
+	}
+
+	adapter.Transports = []string{"http"}
+	if _, err := ApplyAdapterEntries(adapter, servers, globals); err == nil || !strings.Contains(err.Error(), "does not support transport 'stdio'") {
+		t.Errorf("Expected an error for an unsupported stdio server, got %v", err)
+	}
+}
+
+// TestHelperPlugin is not a real test: RunPlugin tests execute the test
+// binary itself as an exec adapter with MCP_TEST_PLUGIN selecting a behaviour.
+func TestHelperPlugin(t *testing.T) {
+	mode := os.Getenv("MCP_TEST_PLUGIN")
+	if mode == "" {
+		return
+	}
+
+	var request PluginRequest
+	if err := json.NewDecoder(os.Stdin).Decode(&request); err != nil {
+		fmt.Fprintf(os.Stderr, "bad request: %v", err)
+		os.Exit(1)
+	}
+
+	switch mode {
+	case "content":
+		out := map[string]interface{}{}
+		for _, server := range request.Servers {
+			out[server["name"].(string)] = request.Settings["label"]
+		}
+		_ = json.NewEncoder(os.Stdout).Encode(out)
+	case "files":
+		_ = json.NewEncoder(os.Stdout).Encode(map[string]interface{}{
+			"files": []map[string]string{
+				{"path": "out/a.yaml", "content": "name: a\n"},
+				{"path": "out/b.yaml", "content": "name: b\n"},
+			},
+		})
+	case "escape":
+		fmt.Print(`{"files": [{"path": "../evil", "content": ""}]}`)
+	case "fail":
+		fmt.Fprint(os.Stderr, "cannot render this client")
+		os.Exit(3)
+	case "slow":
+		time.Sleep(5 * time.Second)
+	}
+	os.Exit(0)
+}
+
+func TestRunPlugin(t *testing.T) {
+	repoRoot := t.TempDir()
+	servers := map[string]ServerConfig{
+		"s1": {"name": "s1", "transport": "stdio", "command": "node"},
+	}
+	globals := NewGlobals(repoRoot, nil)
+
+	adapter := AdapterConfig{
+		Tool:     "exotic",
+		Type:     "exec",
+		Servers:  ServerSelection{"*"},
+		Command:  []string{os.Args[0], "-test.run=^TestHelperPlugin$"},
+		Settings: map[string]interface{}{"label": "hello"},
+	}
+
+	t.Setenv("MCP_TEST_PLUGIN", "content")
+	files, err := RunPlugin(adapter, servers, globals, filepath.Join(repoRoot, "exotic.json"))
+	if err != nil {
+		t.Fatalf("RunPlugin failed: %v", err)
+	}
+	if len(files) != 1 || files[0].Path != filepath.Join(repoRoot, "exotic.json") {
+		t.Fatalf("Unexpected files: %v", files)
+	}
+	if strings.TrimSpace(string(files[0].Content)) != `{"s1":"hello"}` {
+		t.Errorf("Unexpected plugin output: %s", files[0].Content)
+	}
+
+	t.Setenv("MCP_TEST_PLUGIN", "files")
+	adapter.Output = "files"
+	files, err = RunPlugin(adapter, servers, globals, "")
+	if err != nil {
+		t.Fatalf("RunPlugin with file list failed: %v", err)
+	}
+	if len(files) != 2 || files[1].Path != filepath.Join(repoRoot, "out", "b.yaml") || string(files[1].Content) != "name: b\n" {
+		t.Errorf("Unexpected files: %v", files)
+	}
+
+	t.Setenv("MCP_TEST_PLUGIN", "escape")
+	if _, err := RunPlugin(adapter, servers, globals, ""); err == nil || !strings.Contains(err.Error(), "outside the repository") {
+		t.Errorf("Expected error for path outside the repository, got %v", err)
+	}
+
+	t.Setenv("MCP_TEST_PLUGIN", "fail")
+	if _, err := RunPlugin(adapter, servers, globals, ""); err == nil || !strings.Contains(err.Error(), "cannot render this client") {
+		t.Errorf("Expected error including plugin stderr, got %v", err)
+	}
+
+	t.Setenv("MCP_TEST_PLUGIN", "slow")
+	adapter.Timeout = "100ms"
+	if _, err := RunPlugin(adapter, servers, globals, ""); err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	mcpDir := t.TempDir()
+	servers := map[string]ServerConfig{"gitlab": {"name": "gitlab", "transport": "http", "url": "https://gitlab/mcp"}}
+	globals := NewGlobals("/repo", nil)
+
+	if policy, err := LoadPolicy(mcpDir, servers, globals); err != nil || policy != nil {
+		t.Fatalf("Expected no policy without policy.json, got %v, %v", policy, err)
+	}
+
+	writeTestJson(t, filepath.Join(mcpDir, "policy.json"), map[string]interface{}{
+		"rules": []interface{}{
+			map[string]interface{}{"tools": []interface{}{"delete_*"}, "action": "deny", "reason": "no deletions"},
+			map[string]interface{}{"arguments": map[string]interface{}{"*": map[string]interface{}{"outside": "{{repo_root}}"}}, "action": "confirm"},
+		},
+		"servers": map[string]interface{}{
+			"gitlab": []interface{}{
+				map[string]interface{}{"tools": []interface{}{"create_*"}, "arguments": map[string]interface{}{"project": map[string]interface{}{"pattern": "^prod/"}}, "action": "deny"},
+			},
+		},
+	})
+	policy, err := LoadPolicy(mcpDir, servers, globals)
+	if err != nil {
+		t.Fatalf("LoadPolicy failed: %v", err)
+	}
+
+	tests := []struct {
+		server, tool string
+		arguments    map[string]interface{}
+		want         Decision
+	}{
+		{"gitlab", "delete_issue", nil, Decision{ActionDeny, "no deletions"}},
+		{"", "read_file", map[string]interface{}{"path": "src/main.go"}, Decision{Action: ActionAllow}},
+		{"", "read_file", map[string]interface{}{"path": "../secrets"}, Decision{Action: ActionConfirm}},
+		{"", "read_file", map[string]interface{}{"paths": []interface{}{"a", "/etc/passwd"}}, Decision{Action: ActionConfirm}},
+		{"", "delete_file", map[string]interface{}{"path": "/etc/passwd"}, Decision{ActionDeny, "no deletions"}},
+		{"gitlab", "create_issue", map[string]interface{}{"project": "prod/api"}, Decision{Action: ActionDeny}},
+		{"gitlab", "create_issue", map[string]interface{}{"project": "dev/api"}, Decision{Action: ActionAllow}},
+		{"gitlab", "create_issue", map[string]interface{}{"project": map[string]interface{}{"path": "prod/api"}}, Decision{Action: ActionDeny}},
+		{"gitlab", "create_issue", map[string]interface{}{"project": []interface{}{map[string]interface{}{"path": "prod/api"}}}, Decision{Action: ActionDeny}},
+		{"", "write_files", map[string]interface{}{"options": map[string]interface{}{"target": map[string]interface{}{"path": "/etc/passwd"}}}, Decision{Action: ActionConfirm}},
+		{"other", "create_issue", map[string]interface{}{"project": "prod/api"}, Decision{Action: ActionAllow}},
+	}
+	for _, tt := range tests {
+		if got := policy.Check(tt.server, tt.tool, tt.arguments); got != tt.want {
+			t.Errorf("Check(%q, %q, %v) = %+v, want %+v", tt.server, tt.tool, tt.arguments, got, tt.want)
+		}
+	}
+
+	invalid := []struct {
+		policy map[string]interface{}
+		err    string
+	}{
+		{map[string]interface{}{"rules": []interface{}{map[string]interface{}{"action": "block"}}}, "'action' must be deny or confirm"},
+		{map[string]interface{}{"servers": map[string]interface{}{"jira": []interface{}{}}}, "rules for unknown server 'jira'"},
+		{map[string]interface{}{"rules": []interface{}{map[string]interface{}{"action": "deny", "arguments": map[string]interface{}{"path": map[string]interface{}{}}}}}, "needs exactly one of glob, pattern or outside"},
+		{map[string]interface{}{"rules": []interface{}{map[string]interface{}{"action": "deny", "tool": "x"}}}, "unknown field"},
+	}
+	for _, tt := range invalid {
+		writeTestJson(t, filepath.Join(mcpDir, "policy.json"), tt.policy)
+		if _, err := LoadPolicy(mcpDir, servers, globals); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Expected error containing %q, got %v", tt.err, err)
+		}
+	}
+
+	// Without servers, as for a proxy to a URL, server names are not checked.
+	writeTestJson(t, filepath.Join(mcpDir, "policy.json"), map[string]interface{}{"servers": map[string]interface{}{"jira": []interface{}{}}})
+	if _, err := LoadPolicy(mcpDir, nil, globals); err != nil {
+		t.Errorf("Expected server names to go unchecked without servers, got %v", err)
+	}
+}
+
 func writeTestJson(t *testing.T, path string, data interface{}) {
 	file, err := os.Create(path)
 	if err != nil {
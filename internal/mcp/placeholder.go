@@ -0,0 +1,413 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Placeholders have the form {{ path | filter arg ... }} where path is a
+// dotted lookup such as "env.EXAMPLE_MODE" or "args[0]" and each filter
+// transforms the resolved value, e.g. {{cwd | default "."}} or
+// {{args | join " "}}.
+
+type placeholder struct {
+	raw     string
+	path    []pathElem
+	filters []filterCall
+}
+
+type pathElem struct {
+	key   string
+	index int
+	isIdx bool
+}
+
+type filterCall struct {
+	name string
+	args []interface{}
+}
+
+type filterFunc func(value interface{}, resolved bool, args []interface{}) (interface{}, bool, error)
+
+// omitted is what the optional filter yields for a value that cannot be
+// resolved: the enclosing map key or list element is dropped.
+type omittedValue struct{}
+
+var omitted = omittedValue{}
+
+var filters = map[string]filterFunc{
+	"default":  filterDefault,
+	"optional": filterOptional,
+	"join":     filterJoin,
+	"upper":    stringFilter(strings.ToUpper),
+	"lower":    stringFilter(strings.ToLower),
+	"basename": stringFilter(filepath.Base),
+	"json":     filterJSON,
+	"div":      filterDiv,
+}
+
+// expandString replaces every placeholder in s with its value from scope.
+// A string that consists of exactly one placeholder evaluates to the
+// resolved value itself so that lists, maps and numbers keep their type.
+// A placeholder that cannot be resolved is an error; write \{{ to emit
+// literal braces.
+func expandString(s string, scope map[string]interface{}) (interface{}, error) {
+	var out strings.Builder
+	rest := s
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			out.WriteString(rest)
+			break
+		}
+		if start > 0 && rest[start-1] == '\\' {
+			out.WriteString(rest[:start-1])
+			out.WriteString("{{")
+			rest = rest[start+2:]
+			continue
+		}
+		end := findClose(rest, start+2)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated placeholder in '%s'", s)
+		}
+
+		p, err := parsePlaceholder(rest[start : end+2])
+		if err != nil {
+			return nil, err
+		}
+		value, ok, err := p.eval(scope)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("unresolved placeholder %s", p.raw)
+		}
+		if rest == s && start == 0 && end+2 == len(s) {
+			return value, nil
+		}
+
+		out.WriteString(rest[:start])
+		out.WriteString(formatValue(value))
+		rest = rest[end+2:]
+	}
+	return out.String(), nil
+}
+
+// findClose returns the index of the "}}" closing a placeholder opened
+// before from, skipping over quoted filter arguments.
+func findClose(s string, from int) int {
+	inQuote := false
+	for i := from; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && inQuote:
+			i++
+		case s[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && strings.HasPrefix(s[i:], "}}"):
+			return i
+		}
+	}
+	return -1
+}
+
+func parsePlaceholder(raw string) (*placeholder, error) {
+	body := strings.TrimSpace(raw[2 : len(raw)-2])
+	segments, err := splitPipeline(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid placeholder %s: %w", raw, err)
+	}
+
+	path, err := parsePath(strings.TrimSpace(segments[0]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid placeholder %s: %w", raw, err)
+	}
+	p := &placeholder{raw: raw, path: path}
+
+	for _, segment := range segments[1:] {
+		tokens, err := tokenize(segment)
+		if err != nil {
+			return nil, fmt.Errorf("invalid placeholder %s: %w", raw, err)
+		}
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("invalid placeholder %s: empty filter", raw)
+		}
+		name, ok := tokens[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid placeholder %s: filter name must be a word", raw)
+		}
+		if _, known := filters[name]; !known {
+			return nil, fmt.Errorf("invalid placeholder %s: unknown filter '%s'", raw, name)
+		}
+		p.filters = append(p.filters, filterCall{name: name, args: tokens[1:]})
+	}
+	return p, nil
+}
+
+func splitPipeline(body string) ([]string, error) {
+	var segments []string
+	inQuote := false
+	last := 0
+	for i := 0; i < len(body); i++ {
+		switch {
+		case body[i] == '\\' && inQuote:
+			i++
+		case body[i] == '"':
+			inQuote = !inQuote
+		case body[i] == '|' && !inQuote:
+			segments = append(segments, body[last:i])
+			last = i + 1
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated string")
+	}
+	return append(segments, body[last:]), nil
+}
+
+// tokenize splits a filter segment into words and literal arguments.
+// Quoted strings, numbers and booleans become typed values; other words
+// stay as strings.
+func tokenize(segment string) ([]interface{}, error) {
+	var tokens []interface{}
+	s := strings.TrimSpace(segment)
+	for s != "" {
+		if s[0] == '"' {
+			end := 1
+			for ; end < len(s); end++ {
+				if s[end] == '\\' {
+					end++
+					continue
+				}
+				if s[end] == '"' {
+					break
+				}
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			str, err := strconv.Unquote(s[:end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s", s[:end+1])
+			}
+			tokens = append(tokens, str)
+			s = strings.TrimSpace(s[end+1:])
+			continue
+		}
+
+		word := s
+		if i := strings.IndexAny(s, " \t"); i >= 0 {
+			word = s[:i]
+		}
+		s = strings.TrimSpace(s[len(word):])
+
+		if n, err := strconv.ParseInt(word, 10, 64); err == nil {
+			tokens = append(tokens, n)
+		} else if f, err := strconv.ParseFloat(word, 64); err == nil {
+			tokens = append(tokens, f)
+		} else if b, err := strconv.ParseBool(word); err == nil {
+			tokens = append(tokens, b)
+		} else {
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens, nil
+}
+
+func parsePath(expr string) ([]pathElem, error) {
+	if expr == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+
+	var path []pathElem
+	for _, part := range strings.Split(expr, ".") {
+		key := part
+		var indexes []int
+		if i := strings.Index(part, "["); i >= 0 {
+			key = part[:i]
+			rest := part[i:]
+			for rest != "" {
+				end := strings.Index(rest, "]")
+				if rest[0] != '[' || end < 0 {
+					return nil, fmt.Errorf("malformed index in '%s'", expr)
+				}
+				n, err := strconv.Atoi(rest[1:end])
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("invalid index '%s' in '%s'", rest[1:end], expr)
+				}
+				indexes = append(indexes, n)
+				rest = rest[end+1:]
+			}
+		}
+		if key == "" && (len(path) == 0 || len(indexes) == 0) {
+			return nil, fmt.Errorf("empty segment in '%s'", expr)
+		}
+		if key != "" {
+			path = append(path, pathElem{key: key})
+		}
+		for _, n := range indexes {
+			path = append(path, pathElem{index: n, isIdx: true})
+		}
+	}
+	return path, nil
+}
+
+func (p *placeholder) eval(scope map[string]interface{}) (interface{}, bool, error) {
+	value, ok := lookup(scope, p.path)
+	for _, f := range p.filters {
+		var err error
+		value, ok, err = filters[f.name](value, ok, f.args)
+		if err != nil {
+			return nil, false, fmt.Errorf("placeholder %s: filter '%s': %w", p.raw, f.name, err)
+		}
+	}
+	return value, ok, nil
+}
+
+func lookup(root interface{}, path []pathElem) (interface{}, bool) {
+	current := root
+	for _, elem := range path {
+		v := reflect.ValueOf(current)
+		if !v.IsValid() {
+			return nil, false
+		}
+		if elem.isIdx {
+			if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+				return nil, false
+			}
+			if elem.index >= v.Len() {
+				return nil, false
+			}
+			current = v.Index(elem.index).Interface()
+			continue
+		}
+		if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		entry := v.MapIndex(reflect.ValueOf(elem.key).Convert(v.Type().Key()))
+		if !entry.IsValid() {
+			return nil, false
+		}
+		current = entry.Interface()
+	}
+	return current, true
+}
+
+func formatValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	if value == omitted {
+		return ""
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func filterDefault(value interface{}, resolved bool, args []interface{}) (interface{}, bool, error) {
+	if len(args) != 1 {
+		return nil, false, fmt.Errorf("expects exactly one argument")
+	}
+	if !resolved || value == nil || value == "" {
+		return args[0], true, nil
+	}
+	return value, true, nil
+}
+
+func filterOptional(value interface{}, resolved bool, args []interface{}) (interface{}, bool, error) {
+	if len(args) != 0 {
+		return nil, false, fmt.Errorf("takes no arguments")
+	}
+	if !resolved || value == nil {
+		return omitted, true, nil
+	}
+	return value, true, nil
+}
+
+// filterDiv divides a number, e.g. {{timeouts.startup_ms | div 1000}} for
+// clients configured in seconds. Whole results are integers.
+func filterDiv(value interface{}, resolved bool, args []interface{}) (interface{}, bool, error) {
+	if len(args) != 1 {
+		return nil, false, fmt.Errorf("expects exactly one argument")
+	}
+	if !resolved {
+		return value, false, nil
+	}
+	dividend, ok := toFloat(value)
+	if !ok {
+		return nil, false, fmt.Errorf("expects a number, got %T", value)
+	}
+	divisor, ok := toFloat(args[0])
+	if !ok || divisor == 0 {
+		return nil, false, fmt.Errorf("expects a non-zero number argument")
+	}
+	result := dividend / divisor
+	if result == float64(int64(result)) {
+		return int64(result), true, nil
+	}
+	return result, true, nil
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func filterJoin(value interface{}, resolved bool, args []interface{}) (interface{}, bool, error) {
+	if len(args) != 1 {
+		return nil, false, fmt.Errorf("expects exactly one argument")
+	}
+	if !resolved {
+		return value, false, nil
+	}
+	sep := formatValue(args[0])
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, false, fmt.Errorf("expects a list, got %T", value)
+	}
+	parts := make([]string, v.Len())
+	for i := range parts {
+		parts[i] = formatValue(v.Index(i).Interface())
+	}
+	return strings.Join(parts, sep), true, nil
+}
+
+func filterJSON(value interface{}, resolved bool, args []interface{}) (interface{}, bool, error) {
+	if len(args) != 0 {
+		return nil, false, fmt.Errorf("takes no arguments")
+	}
+	if !resolved {
+		return value, false, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, false, err
+	}
+	return string(data), true, nil
+}
+
+func stringFilter(fn func(string) string) filterFunc {
+	return func(value interface{}, resolved bool, args []interface{}) (interface{}, bool, error) {
+		if len(args) != 0 {
+			return nil, false, fmt.Errorf("takes no arguments")
+		}
+		if !resolved {
+			return value, false, nil
+		}
+		s, ok := value.(string)
+		if !ok {
+			return nil, false, fmt.Errorf("expects a string, got %T", value)
+		}
+		return fn(s), true, nil
+	}
+}
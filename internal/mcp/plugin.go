@@ -0,0 +1,129 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const defaultPluginTimeout = 30 * time.Second
+
+// OutputFile is a rendered file produced by an adapter.
+type OutputFile struct {
+	Path    string
+	Content []byte
+}
+
+// PluginRequest is the JSON document an exec adapter receives on stdin.
+type PluginRequest struct {
+	Tool       string                 `json:"tool"`
+	OutputPath string                 `json:"output_path"`
+	FormatType string                 `json:"format_type"`
+	Settings   map[string]interface{} `json:"settings"`
+	Servers    []ServerConfig         `json:"servers"`
+	Globals    Globals                `json:"globals"`
+}
+
+// pluginFiles is the structured stdout of an exec adapter with
+// "output": "files". Paths are relative to the repo root.
+type pluginFiles struct {
+	Files []struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+	} `json:"files"`
+}
+
+// RunPlugin renders an exec adapter by running its command from the repo
+// root, writing a PluginRequest to its stdin and reading the rendered file
+// from its stdout. With "output": "files" the plugin instead prints a
+// {"files": [{"path", "content"}]} list and may produce several files.
+func RunPlugin(adapter AdapterConfig, servers map[string]ServerConfig, globals Globals, outputPath string) ([]OutputFile, error) {
+	if len(adapter.Command) == 0 {
+		return nil, fmt.Errorf("%s: exec adapter is missing 'command'", adapter.describe())
+	}
+
+	names, err := adapter.selectedServers(servers)
+	if err != nil {
+		return nil, err
+	}
+	request := PluginRequest{
+		Tool:       adapter.Tool,
+		OutputPath: outputPath,
+		FormatType: adapter.formatType(),
+		Settings:   adapter.Settings,
+		Servers:    make([]ServerConfig, 0, len(names)),
+		Globals:    globals,
+	}
+	for _, name := range names {
+		serverConfig, err := adapter.resolveServer(name, servers, globals)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", adapter.describe(), err)
+		}
+		request.Servers = append(request.Servers, serverConfig)
+	}
+
+	input, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to encode plugin request: %w", adapter.describe(), err)
+	}
+
+	timeout := defaultPluginTimeout
+	if adapter.Timeout != "" {
+		timeout, err = time.ParseDuration(adapter.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid timeout '%s': %w", adapter.describe(), adapter.Timeout, err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	repoRoot, _ := globals["repo_root"].(string)
+	cmd := exec.CommandContext(ctx, adapter.Command[0], adapter.Command[1:]...)
+	cmd.Dir = repoRoot
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s", timeout)
+		}
+		return nil, fmt.Errorf("%s: plugin %s failed: %w%s", adapter.describe(), adapter.Command[0], err, formatStderr(stderr.String()))
+	}
+
+	if adapter.Output != "files" {
+		if err := validateRendered(stdout.Bytes(), adapter.FormatType); err != nil {
+			return nil, fmt.Errorf("%s: plugin output is not valid %s: %w%s", adapter.describe(), adapter.formatType(), err, formatStderr(stderr.String()))
+		}
+		return []OutputFile{{Path: outputPath, Content: stdout.Bytes()}}, nil
+	}
+
+	var listing pluginFiles
+	if err := json.Unmarshal(stdout.Bytes(), &listing); err != nil {
+		return nil, fmt.Errorf("%s: plugin output is not a file list: %w%s", adapter.describe(), err, formatStderr(stderr.String()))
+	}
+	files := make([]OutputFile, 0, len(listing.Files))
+	for _, f := range listing.Files {
+		rel := filepath.Clean(f.Path)
+		if f.Path == "" || filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("%s: plugin returned path '%s' outside the repository", adapter.describe(), f.Path)
+		}
+		files = append(files, OutputFile{Path: filepath.Join(repoRoot, rel), Content: []byte(f.Content)})
+	}
+	return files, nil
+}
+
+func formatStderr(stderr string) string {
+	stderr = strings.TrimSpace(stderr)
+	if stderr == "" {
+		return ""
+	}
+	return "\nplugin stderr:\n" + stderr
+}
@@ -0,0 +1,238 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Policy actions. A call matched by several rules gets the strictest.
+const (
+	ActionAllow   = "allow"
+	ActionConfirm = "confirm"
+	ActionDeny    = "deny"
+)
+
+// Policy gates the tool calls mcp-bridge passes to servers. It is read from
+// .ai/mcp/policy.json: Rules apply to every server and Servers holds more
+// rules for canonical servers by name.
+type Policy struct {
+	Rules   []PolicyRule            `json:"rules"`
+	Servers map[string][]PolicyRule `json:"servers"`
+}
+
+// PolicyRule matches calls to the tools named by Tools (glob patterns; none
+// means every tool) whose arguments meet all of Arguments.
+type PolicyRule struct {
+	Tools     []string                      `json:"tools"`
+	Arguments map[string]*ArgumentCondition `json:"arguments"`
+	Action    string                        `json:"action"`
+	Reason    string                        `json:"reason"`
+}
+
+// ArgumentCondition matches a string argument, or a list or object with a
+// matching string anywhere inside, by exactly one of a glob, a regular
+// expression or being a path outside a directory. The argument name "*"
+// matches any argument.
+type ArgumentCondition struct {
+	Glob    string `json:"glob"`
+	Pattern string `json:"pattern"`
+	Outside string `json:"outside"`
+
+	pattern *regexp.Regexp
+}
+
+// Decision is the outcome of checking a call against a Policy.
+type Decision struct {
+	Action string
+	Reason string
+}
+
+// LoadPolicy reads mcpDir/policy.json, expanding placeholders such as
+// {{repo_root}}. A missing file yields a nil Policy, which allows
+// everything. Rules under 'servers' must name one of servers unless servers
+// is nil.
+func LoadPolicy(mcpDir string, servers map[string]ServerConfig, globals Globals) (*Policy, error) {
+	var raw map[string]interface{}
+	policyPath := filepath.Join(mcpDir, "policy.json")
+	if err := readJSONFile(policyPath, &raw); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	expanded, err := substitute(raw, globals.scope(nil), "policy")
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(expanded)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var policy Policy
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", policyPath, err)
+	}
+
+	repoRoot, _ := globals["repo_root"].(string)
+	if err := validateRules(policy.Rules, "rules", repoRoot); err != nil {
+		return nil, err
+	}
+	for name, rules := range policy.Servers {
+		if _, ok := servers[name]; !ok && servers != nil {
+			return nil, fmt.Errorf("rules for unknown server '%s'", name)
+		}
+		if err := validateRules(rules, "servers."+name, repoRoot); err != nil {
+			return nil, err
+		}
+	}
+	return &policy, nil
+}
+
+func validateRules(rules []PolicyRule, where, repoRoot string) error {
+	for i := range rules {
+		rule := &rules[i]
+		at := fmt.Sprintf("%s[%d]", where, i)
+		if rule.Action != ActionDeny && rule.Action != ActionConfirm {
+			return fmt.Errorf("%s: 'action' must be deny or confirm", at)
+		}
+		for _, pattern := range rule.Tools {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%s: invalid tool pattern '%s'", at, pattern)
+			}
+		}
+		for arg, cond := range rule.Arguments {
+			if cond == nil {
+				return fmt.Errorf("%s: argument '%s' needs a condition", at, arg)
+			}
+			set := 0
+			for _, v := range []string{cond.Glob, cond.Pattern, cond.Outside} {
+				if v != "" {
+					set++
+				}
+			}
+			if set != 1 {
+				return fmt.Errorf("%s: argument '%s' needs exactly one of glob, pattern or outside", at, arg)
+			}
+			if cond.Glob != "" {
+				if _, err := path.Match(cond.Glob, ""); err != nil {
+					return fmt.Errorf("%s: invalid glob '%s' for argument '%s'", at, cond.Glob, arg)
+				}
+			}
+			if cond.Pattern != "" {
+				re, err := regexp.Compile(cond.Pattern)
+				if err != nil {
+					return fmt.Errorf("%s: invalid pattern for argument '%s': %v", at, arg, err)
+				}
+				cond.pattern = re
+			}
+			if cond.Outside != "" && !filepath.IsAbs(cond.Outside) {
+				cond.Outside = filepath.Join(repoRoot, cond.Outside)
+			}
+		}
+	}
+	return nil
+}
+
+// Check decides whether a call of tool on the canonical server may go
+// ahead. server is "" when the server has no canonical definition.
+func (p *Policy) Check(server, tool string, arguments map[string]interface{}) Decision {
+	decision := Decision{Action: ActionAllow}
+	if p == nil {
+		return decision
+	}
+	rules := append(append([]PolicyRule{}, p.Servers[server]...), p.Rules...)
+	for _, rule := range rules {
+		if !rule.matches(tool, arguments) {
+			continue
+		}
+		if decision.Action == ActionDeny || (decision.Action == ActionConfirm && rule.Action == ActionConfirm) {
+			continue
+		}
+		decision = Decision{Action: rule.Action, Reason: rule.Reason}
+	}
+	return decision
+}
+
+func (r PolicyRule) matches(tool string, arguments map[string]interface{}) bool {
+	if len(r.Tools) > 0 {
+		matched := false
+		for _, pattern := range r.Tools {
+			if ok, _ := path.Match(pattern, tool); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for name, cond := range r.Arguments {
+		if name == "*" {
+			matched := false
+			for _, value := range arguments {
+				if cond.matches(value) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+		} else if !cond.matches(arguments[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *ArgumentCondition) matches(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		switch {
+		case c.Glob != "":
+			ok, _ := path.Match(c.Glob, v)
+			return ok
+		case c.pattern != nil:
+			return c.pattern.MatchString(v)
+		default:
+			return isOutside(v, c.Outside)
+		}
+	case []interface{}:
+		for _, item := range v {
+			if c.matches(item) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			if c.matches(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isOutside reports whether p, relative paths taken from dir, is outside
+// dir. "~" counts as the home directory.
+func isOutside(p, dir string) bool {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		home, _ := os.UserHomeDir()
+		p = filepath.Join(home, strings.TrimPrefix(p, "~"))
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(p))
+	return err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,109 @@
+package mcp
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Built-in presets are adapter definitions for well-known clients. An
+// adapter file that names a preset is merged over it, so it only needs to
+// state what differs. Each preset carries a preset_version that is bumped
+// whenever its output changes; "preset": "cursor@1" pins an adapter to a
+// version so that an upgrade fails loudly instead of silently changing files.
+//
+//go:embed presets/*.json
+var presetFiles embed.FS
+
+func loadPreset(name string) (map[string]interface{}, error) {
+	data, err := presetFiles.ReadFile("presets/" + name + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("unknown preset '%s'", name)
+	}
+
+	var preset map[string]interface{}
+	if err := json.Unmarshal(data, &preset); err != nil {
+		return nil, fmt.Errorf("failed to parse preset '%s': %w", name, err)
+	}
+	return preset, nil
+}
+
+// PresetInfo summarises a built-in preset for listing.
+type PresetInfo struct {
+	Name        string
+	Version     int
+	Tool        string
+	OutputPath  string
+	Description string
+}
+
+func ListPresets() ([]PresetInfo, error) {
+	files, err := presetFiles.ReadDir("presets")
+	if err != nil {
+		return nil, err
+	}
+
+	var presets []PresetInfo
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), path.Ext(file.Name()))
+		preset, err := loadPreset(name)
+		if err != nil {
+			return nil, err
+		}
+		version, _ := preset["preset_version"].(float64)
+		info := PresetInfo{Name: name, Version: int(version)}
+		info.Tool, _ = preset["tool"].(string)
+		info.OutputPath, _ = preset["output_path"].(string)
+		info.Description, _ = preset["description"].(string)
+		presets = append(presets, info)
+	}
+
+	sort.Slice(presets, func(i, j int) bool {
+		return presets[i].Name < presets[j].Name
+	})
+	return presets, nil
+}
+
+// applyPreset merges an adapter file's raw JSON over the preset it names.
+func applyPreset(raw map[string]interface{}) (map[string]interface{}, error) {
+	ref, ok := raw["preset"].(string)
+	if !ok || ref == "" {
+		return raw, nil
+	}
+
+	name, pinned, hasPin := strings.Cut(ref, "@")
+	preset, err := loadPreset(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasPin {
+		want, err := strconv.Atoi(pinned)
+		if err != nil {
+			return nil, fmt.Errorf("invalid preset version in '%s'", ref)
+		}
+		if have, _ := preset["preset_version"].(float64); int(have) != want {
+			return nil, fmt.Errorf("preset '%s' is version %d, but the adapter pins version %d", name, int(have), want)
+		}
+	}
+	// A field that selects servers or a mapping replaces the preset's
+	// alternative to it instead of being outranked by it.
+	for field, alternative := range presetAlternatives {
+		if _, ok := raw[field]; ok {
+			delete(preset, alternative)
+		}
+	}
+	return deepMerge(preset, raw), nil
+}
+
+// presetAlternatives pairs adapter fields that exclude each other.
+var presetAlternatives = map[string]string{
+	"server":               "servers",
+	"servers":              "server",
+	"mapping":              "mapping_by_transport",
+	"mapping_by_transport": "mapping",
+}
@@ -0,0 +1,261 @@
+package mcp
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A Renderer adds client-specific structure that a mapping cannot express
+// to the document built for an adapter. Entries share their Config maps
+// with the document, so changes to them are reflected in the output.
+type Renderer func(document map[string]interface{}, entries []Entry) error
+
+var renderers = map[string]Renderer{
+	"claude":          renderClaude,
+	"claude-settings": renderClaudeSettings,
+	"cursor":          renderCursor,
+	"gemini":          renderGemini,
+	"vscode":          renderVSCode,
+	"windsurf":        renderWindsurf,
+}
+
+// rendererSettings lists the canonical server fields each renderer writes
+// itself, so that adapters using it are not warned about or rewritten for
+// them.
+var rendererSettings = map[string][]string{
+	"claude":          {"auth"},
+	"claude-settings": {"approval"},
+	"cursor":          {"auth"},
+	"gemini":          {"auth"},
+	"vscode":          {"auth"},
+	"windsurf":        {"auth"},
+}
+
+// settingsRenderers write a client's settings file rather than its server
+// list, so only the settings they render matter; the client's server
+// adapter reports the others.
+var settingsRenderers = map[string]bool{
+	"claude-settings": true,
+}
+
+// rendererMerges replace mergeCollection for renderers whose collection is
+// not keyed by entry name.
+var rendererMerges = map[string]func(existing, generated interface{}, entries []Entry) interface{}{
+	"claude-settings": mergeClaudePermissions,
+}
+
+func applyRenderer(name string, document map[string]interface{}, entries []Entry) error {
+	if name == "" {
+		return nil
+	}
+	renderer, ok := renderers[name]
+	if !ok {
+		return fmt.Errorf("unknown renderer '%s'", name)
+	}
+	return renderer(document, entries)
+}
+
+// secretRef matches canonical secret references such as ${GITLAB_TOKEN}.
+var secretRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// renderVSCode turns secret references in env and headers into promptString
+// inputs, which VS Code asks the user for and substitutes as ${input:id}.
+func renderVSCode(document map[string]interface{}, entries []Entry) error {
+	inputs := map[string]map[string]interface{}{}
+
+	for _, entry := range entries {
+		for _, field := range []string{"env", "headers"} {
+			values, ok := entry.Config[field].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for key, value := range values {
+				s, ok := value.(string)
+				if !ok {
+					continue
+				}
+				values[key] = secretRef.ReplaceAllStringFunc(s, func(ref string) string {
+					variable := secretRef.FindStringSubmatch(ref)[1]
+					id := strings.ToLower(strings.ReplaceAll(variable, "_", "-"))
+					if _, exists := inputs[id]; !exists {
+						inputs[id] = map[string]interface{}{
+							"type":        "promptString",
+							"id":          id,
+							"description": fmt.Sprintf("%s for MCP server '%s'", variable, entry.Name),
+							"password":    true,
+						}
+					}
+					return "${input:" + id + "}"
+				})
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(inputs))
+	for id := range inputs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	list := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, inputs[id])
+	}
+	document["inputs"] = list
+	return nil
+}
+
+// geminiOAuthFields maps canonical auth fields to Gemini's oauth block.
+var geminiOAuthFields = map[string]string{
+	"client_id":         "clientId",
+	"client_secret":     "clientSecret",
+	"scopes":            "scopes",
+	"authorization_url": "authorizationUrl",
+	"token_url":         "tokenUrl",
+	"redirect_uri":      "redirectUri",
+}
+
+// renderGemini adds an oauth block to the entries of servers with OAuth auth.
+func renderGemini(document map[string]interface{}, entries []Entry) error {
+	addOAuth(entries, "oauth", geminiOAuthFields, map[string]interface{}{"enabled": true})
+	return nil
+}
+
+// renderClaude passes the client ID of servers with OAuth auth to Claude
+// Code, which discovers the endpoints and asks for a client secret itself.
+func renderClaude(document map[string]interface{}, entries []Entry) error {
+	addOAuth(entries, "oauth", map[string]string{"client_id": "clientId"}, nil)
+	return nil
+}
+
+// cursorOAuthFields maps canonical auth fields to Cursor's static OAuth
+// client settings.
+var cursorOAuthFields = map[string]string{
+	"client_id":     "CLIENT_ID",
+	"client_secret": "CLIENT_SECRET",
+	"scopes":        "scopes",
+}
+
+// renderCursor adds an auth block to the entries of servers with OAuth auth.
+func renderCursor(document map[string]interface{}, entries []Entry) error {
+	addOAuth(entries, "auth", cursorOAuthFields, nil)
+	return nil
+}
+
+// renderWindsurf writes nothing: Windsurf runs the OAuth flow from the
+// server URL alone and has no settings for it.
+func renderWindsurf(document map[string]interface{}, entries []Entry) error {
+	return nil
+}
+
+// addOAuth sets key on the entries of remote servers with OAuth auth to a
+// block holding base and the auth fields named in fields, renamed. No block
+// is added when it would be empty.
+func addOAuth(entries []Entry, key string, fields map[string]string, base map[string]interface{}) {
+	for _, entry := range entries {
+		auth, ok := entry.Server["auth"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		// Servers rewritten to stdio get OAuth from their wrapper.
+		if _, ok := entry.Config["command"]; ok {
+			continue
+		}
+		block := map[string]interface{}{}
+		for k, v := range base {
+			block[k] = v
+		}
+		for field, name := range fields {
+			if value, ok := auth[field]; ok {
+				block[name] = value
+			}
+		}
+		if len(block) > 0 {
+			entry.Config[key] = block
+		}
+	}
+}
+
+// claudeNameChars matches the characters Claude Code replaces in server
+// names when naming their tools.
+var claudeNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// claudeRule is the permission rule for a server's tool, or for all of its
+// tools when tool is "".
+func claudeRule(server, tool string) string {
+	rule := "mcp__" + claudeNameChars.ReplaceAllString(server, "_")
+	if tool != "" {
+		rule += "__" + tool
+	}
+	return rule
+}
+
+// renderClaudeSettings replaces the permissions collection with the allow
+// and ask rules for the servers' approval settings: trusted servers and
+// auto-approved tools are allowed, servers that always ask are asked for.
+func renderClaudeSettings(document map[string]interface{}, entries []Entry) error {
+	allow, ask := []interface{}{}, []interface{}{}
+	for _, entry := range entries {
+		approval, _ := entry.Server["approval"].(map[string]interface{})
+		if approval["trusted"] == true {
+			allow = append(allow, claudeRule(entry.Name, ""))
+		}
+		tools, _ := approval["auto_approve_tools"].([]interface{})
+		for _, tool := range tools {
+			allow = append(allow, claudeRule(entry.Name, fmt.Sprint(tool)))
+		}
+		if approval["always_ask"] == true {
+			ask = append(ask, claudeRule(entry.Name, ""))
+		}
+	}
+
+	permissions := map[string]interface{}{}
+	if len(allow) > 0 {
+		permissions["allow"] = allow
+	}
+	if len(ask) > 0 {
+		permissions["ask"] = ask
+	}
+	document["permissions"] = permissions
+	return nil
+}
+
+// mergeClaudePermissions replaces the allow and ask rules of the generated
+// servers in existing permissions, keeping every other rule and setting.
+func mergeClaudePermissions(existing, generated interface{}, entries []Entry) interface{} {
+	current, _ := existing.(map[string]interface{})
+	result := make(map[string]interface{}, len(current)+2)
+	for k, v := range current {
+		result[k] = v
+	}
+
+	owned := func(rule string) bool {
+		for _, entry := range entries {
+			prefix := claudeRule(entry.Name, "")
+			if rule == prefix || strings.HasPrefix(rule, prefix+"__") {
+				return true
+			}
+		}
+		return false
+	}
+	for _, key := range []string{"allow", "ask"} {
+		var rules []interface{}
+		list, _ := current[key].([]interface{})
+		for _, rule := range list {
+			if s, ok := rule.(string); ok && owned(s) {
+				continue
+			}
+			rules = append(rules, rule)
+		}
+		add, _ := generated.(map[string]interface{})[key].([]interface{})
+		rules = append(rules, add...)
+		if len(rules) > 0 {
+			result[key] = rules
+		} else {
+			delete(result, key)
+		}
+	}
+	return result
+}
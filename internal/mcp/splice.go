@@ -0,0 +1,668 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A Splicer is a Format that can set one value inside an existing file
+// without re-encoding the rest of it, so that comments and formatting
+// survive a merge.
+type Splicer interface {
+	// Splice returns content with the value at path replaced by value, or
+	// added if the path does not exist. ok is false if the file's layout
+	// does not allow it.
+	Splice(content []byte, path []string, value interface{}) (spliced []byte, ok bool)
+	// HasComments reports whether content has comments a rewrite would lose.
+	HasComments(content []byte) bool
+}
+
+// writeMerged writes a document merged by mergeExisting over the file it
+// was merged into. Formats that can splice only rewrite the entries that
+// changed; a file whose comments would otherwise be lost is refused.
+func writeMerged(outputPath string, format Format, merged map[string]interface{}, insertPath []string) error {
+	splicer, ok := format.(Splicer)
+	content, err := os.ReadFile(outputPath)
+	if !ok || err != nil || len(bytes.TrimSpace(content)) == 0 {
+		return writeEncoded(outputPath, format, merged)
+	}
+	spliced, err := splice(format, splicer, content, merged, insertPath)
+	if err != nil {
+		if splicer.HasComments(content) {
+			return fmt.Errorf("cannot update %s without losing its comments: %w", outputPath, err)
+		}
+		return writeEncoded(outputPath, format, merged)
+	}
+	if bytes.Equal(spliced, content) {
+		return nil
+	}
+	if err := os.WriteFile(outputPath, spliced, 0644); err != nil {
+		return fmt.Errorf("failed to create file %s: %w", outputPath, err)
+	}
+	return nil
+}
+
+// splice applies the changes between the file's content and merged, and
+// checks that the result reads back as merged.
+func splice(format Format, splicer Splicer, content []byte, merged map[string]interface{}, insertPath []string) ([]byte, error) {
+	existing, err := decodeFile(format, content)
+	if err != nil {
+		return nil, err
+	}
+	want, err := normalize(format, merged)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := spliceChanges(existing, want, insertPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range changes {
+		value, _ := lookupKeys(merged, path)
+		var ok bool
+		if content, ok = splicer.Splice(content, path, value); !ok {
+			return nil, fmt.Errorf("cannot locate '%s'", strings.Join(path, "."))
+		}
+	}
+
+	got, err := decodeFile(format, content)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		return nil, errors.New("the file's layout is not supported")
+	}
+	return content, nil
+}
+
+// spliceChanges lists the paths to set to turn existing into merged: every
+// changed entry of the collection at insertPath, or the whole collection if
+// entries were removed from it. Changes outside the collection are not
+// spliced.
+func spliceChanges(existing, merged interface{}, insertPath []string) ([][]string, error) {
+	if !reflect.DeepEqual(without(existing, insertPath), without(merged, insertPath)) {
+		return nil, errors.New("settings outside the generated entries changed")
+	}
+	generated, _ := lookupKeys(merged, insertPath)
+	current, found := lookupKeys(existing, insertPath)
+	if !found {
+		return [][]string{insertPath}, nil
+	}
+
+	currentMap, ok1 := current.(map[string]interface{})
+	generatedMap, ok2 := generated.(map[string]interface{})
+	if !ok1 || !ok2 {
+		if reflect.DeepEqual(current, generated) {
+			return nil, nil
+		}
+		return [][]string{insertPath}, nil
+	}
+	for key := range currentMap {
+		if _, ok := generatedMap[key]; !ok {
+			return [][]string{insertPath}, nil
+		}
+	}
+
+	keys := make([]string, 0, len(generatedMap))
+	for key := range generatedMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var changes [][]string
+	for _, key := range keys {
+		if !reflect.DeepEqual(currentMap[key], generatedMap[key]) {
+			changes = append(changes, append(append([]string{}, insertPath...), key))
+		}
+	}
+	return changes, nil
+}
+
+// decodeFile parses an existing file; JSON may have comments and trailing
+// commas.
+func decodeFile(format Format, content []byte) (interface{}, error) {
+	if _, ok := format.(jsonFormat); ok {
+		content = stripJSONC(content)
+	}
+	return format.Decode(content)
+}
+
+// normalize gives data the types the format decodes to.
+func normalize(format Format, data interface{}) (interface{}, error) {
+	encoded, err := format.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+	return format.Decode(encoded)
+}
+
+func lookupKeys(value interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// without returns a copy of value with the key at path removed.
+func without(value interface{}, path []string) interface{} {
+	m, ok := value.(map[string]interface{})
+	if !ok || len(path) == 0 {
+		return value
+	}
+	copied := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		copied[k] = v
+	}
+	if len(path) == 1 {
+		delete(copied, path[0])
+	} else if child, ok := copied[path[0]]; ok {
+		copied[path[0]] = without(child, path[1:])
+	}
+	return copied
+}
+
+// nest wraps value in one map per key of path.
+func nest(path []string, value interface{}) interface{} {
+	for i := len(path) - 1; i >= 0; i-- {
+		value = map[string]interface{}{path[i]: value}
+	}
+	return value
+}
+
+func (jsonFormat) HasComments(content []byte) bool {
+	return !bytes.Equal(stripComments(content), content)
+}
+
+func (jsonFormat) Splice(content []byte, path []string, value interface{}) ([]byte, bool) {
+	s := &jsoncScanner{data: content}
+	s.skipSpace()
+	object := s.pos
+	for i, key := range path {
+		s.pos = object
+		members, closing, ok := s.members()
+		if !ok {
+			return nil, false
+		}
+		var found *jsoncMember
+		for j := range members {
+			if members[j].key == key {
+				found = &members[j]
+			}
+		}
+		if found == nil {
+			return insertJSONMember(content, object, members, closing, key, nest(path[i+1:], value))
+		}
+		if i == len(path)-1 {
+			encoded, ok := encodeJSONAt(value, lineIndent(content, found.keyStart))
+			if !ok {
+				return nil, false
+			}
+			return splicedBytes(content, found.start, found.end, encoded), true
+		}
+		object = found.start
+	}
+	return nil, false
+}
+
+// insertJSONMember adds key as the last member of the object starting at
+// object, indented like its other members.
+func insertJSONMember(content []byte, object int, members []jsoncMember, closing int, key string, value interface{}) ([]byte, bool) {
+	indent := lineIndent(content, object) + "  "
+	if len(members) > 0 {
+		indent = lineIndent(content, members[0].keyStart)
+	}
+	encoded, ok := encodeJSONAt(value, indent)
+	if !ok {
+		return nil, false
+	}
+	name, _ := json.Marshal(key)
+
+	at := closing
+	for at > object+1 && strings.ContainsRune(" \t\r\n", rune(content[at-1])) {
+		at--
+	}
+	var out bytes.Buffer
+	start := 0
+	if len(members) > 0 {
+		last := members[len(members)-1].end
+		s := &jsoncScanner{data: content, pos: last}
+		s.skipSpace()
+		out.Write(content[:last])
+		if content[s.pos] != ',' {
+			out.WriteByte(',')
+		}
+		start = last
+	}
+	out.Write(content[start:at])
+	out.WriteString("\n" + indent + string(name) + ": " + encoded)
+	if !bytes.Contains(content[at:closing], []byte("\n")) {
+		out.WriteString("\n" + lineIndent(content, object))
+	}
+	out.Write(content[at:])
+	return out.Bytes(), true
+}
+
+// encodeJSONAt encodes value as jsonFormat does, for a line indented by
+// indent.
+func encodeJSONAt(value interface{}, indent string) (string, bool) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent(indent, "  ")
+	if err := encoder.Encode(value); err != nil {
+		return "", false
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), true
+}
+
+// lineIndent returns the whitespace that starts the line containing pos.
+func lineIndent(content []byte, pos int) string {
+	start := bytes.LastIndexByte(content[:pos], '\n') + 1
+	end := start
+	for end < len(content) && (content[end] == ' ' || content[end] == '\t') {
+		end++
+	}
+	return string(content[start:end])
+}
+
+func splicedBytes(content []byte, start, end int, replacement string) []byte {
+	out := make([]byte, 0, len(content)-(end-start)+len(replacement))
+	out = append(out, content[:start]...)
+	out = append(out, replacement...)
+	return append(out, content[end:]...)
+}
+
+// jsoncScanner walks JSON with comments and trailing commas.
+type jsoncScanner struct {
+	data []byte
+	pos  int
+}
+
+// jsoncMember is an object member: where its key starts and its value's
+// span.
+type jsoncMember struct {
+	key        string
+	keyStart   int
+	start, end int
+}
+
+func (s *jsoncScanner) skipSpace() {
+	for s.pos < len(s.data) {
+		c := s.data[s.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			s.pos++
+		case c == '/' && s.pos+1 < len(s.data) && s.data[s.pos+1] == '/':
+			for s.pos < len(s.data) && s.data[s.pos] != '\n' {
+				s.pos++
+			}
+		case c == '/' && s.pos+1 < len(s.data) && s.data[s.pos+1] == '*':
+			end := bytes.Index(s.data[s.pos+2:], []byte("*/"))
+			if end < 0 {
+				s.pos = len(s.data)
+				return
+			}
+			s.pos += end + 4
+		default:
+			return
+		}
+	}
+}
+
+func (s *jsoncScanner) skipString() bool {
+	for s.pos++; s.pos < len(s.data); s.pos++ {
+		switch s.data[s.pos] {
+		case '\\':
+			s.pos++
+		case '"':
+			s.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (s *jsoncScanner) skipValue() bool {
+	if s.pos >= len(s.data) {
+		return false
+	}
+	switch c := s.data[s.pos]; c {
+	case '"':
+		return s.skipString()
+	case '{', '[':
+		closing := byte('}')
+		if c == '[' {
+			closing = ']'
+		}
+		s.pos++
+		for {
+			s.skipSpace()
+			if s.pos >= len(s.data) {
+				return false
+			}
+			switch s.data[s.pos] {
+			case closing:
+				s.pos++
+				return true
+			case ',', ':':
+				s.pos++
+			default:
+				if !s.skipValue() {
+					return false
+				}
+			}
+		}
+	default:
+		start := s.pos
+		for s.pos < len(s.data) && !strings.ContainsRune(" \t\r\n,:]}/", rune(s.data[s.pos])) {
+			s.pos++
+		}
+		return s.pos > start
+	}
+}
+
+// members lists the members of the object at s.pos and returns the position
+// of its closing brace.
+func (s *jsoncScanner) members() ([]jsoncMember, int, bool) {
+	if s.pos >= len(s.data) || s.data[s.pos] != '{' {
+		return nil, 0, false
+	}
+	s.pos++
+	var members []jsoncMember
+	for {
+		s.skipSpace()
+		if s.pos >= len(s.data) {
+			return nil, 0, false
+		}
+		switch s.data[s.pos] {
+		case '}':
+			return members, s.pos, true
+		case ',':
+			s.pos++
+			continue
+		case '"':
+		default:
+			return nil, 0, false
+		}
+		keyStart := s.pos
+		if !s.skipString() {
+			return nil, 0, false
+		}
+		var key string
+		if json.Unmarshal(s.data[keyStart:s.pos], &key) != nil {
+			return nil, 0, false
+		}
+		s.skipSpace()
+		if s.pos >= len(s.data) || s.data[s.pos] != ':' {
+			return nil, 0, false
+		}
+		s.pos++
+		s.skipSpace()
+		start := s.pos
+		if !s.skipValue() {
+			return nil, 0, false
+		}
+		members = append(members, jsoncMember{key: key, keyStart: keyStart, start: start, end: s.pos})
+	}
+}
+
+func (yamlFormat) HasComments(content []byte) bool {
+	var doc yaml.Node
+	if yaml.Unmarshal(content, &doc) != nil {
+		return bytes.ContainsRune(content, '#')
+	}
+	var commented func(node *yaml.Node) bool
+	commented = func(node *yaml.Node) bool {
+		if node.HeadComment != "" || node.LineComment != "" || node.FootComment != "" {
+			return true
+		}
+		for _, child := range node.Content {
+			if commented(child) {
+				return true
+			}
+		}
+		return false
+	}
+	return commented(&doc)
+}
+
+func (yamlFormat) Splice(content []byte, path []string, value interface{}) ([]byte, bool) {
+	var doc yaml.Node
+	if yaml.Unmarshal(content, &doc) != nil || doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, false
+	}
+	node := doc.Content[0]
+	for i, key := range path {
+		if node.Kind != yaml.MappingNode {
+			return nil, false
+		}
+		index := -1
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if node.Content[j].Value == key {
+				index = j + 1
+			}
+		}
+		if index < 0 || i == len(path)-1 {
+			replacement := &yaml.Node{}
+			if index < 0 {
+				if replacement.Encode(nest(path[i+1:], value)) != nil {
+					return nil, false
+				}
+				name := &yaml.Node{}
+				name.SetString(key)
+				node.Content = append(node.Content, name, replacement)
+			} else {
+				if replacement.Encode(value) != nil {
+					return nil, false
+				}
+				node.Content[index] = replacement
+			}
+			break
+		}
+		node = node.Content[index]
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if encoder.Encode(&doc) != nil || encoder.Close() != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+func (tomlFormat) HasComments(content []byte) bool {
+	quote := ""
+	for i := 0; i < len(content); i++ {
+		rest := content[i:]
+		switch {
+		case quote != "":
+			if quote[0] == '"' && content[i] == '\\' {
+				i++
+			} else if bytes.HasPrefix(rest, []byte(quote)) {
+				i += len(quote) - 1
+				quote = ""
+			}
+		case bytes.HasPrefix(rest, []byte(`"""`)) || bytes.HasPrefix(rest, []byte("'''")):
+			quote = string(rest[:3])
+			i += 2
+		case content[i] == '"' || content[i] == '\'':
+			quote = string(content[i])
+		case content[i] == '#':
+			return true
+		}
+	}
+	return false
+}
+
+// Splice replaces the tables at path, and the tables nested in them, with
+// value encoded as tables; only table values can be spliced.
+func (f tomlFormat) Splice(content []byte, path []string, value interface{}) ([]byte, bool) {
+	if _, ok := value.(map[string]interface{}); !ok {
+		return nil, false
+	}
+	encoded, err := f.Encode(nest(path, value))
+	if err != nil {
+		return nil, false
+	}
+	// The encoder writes a header for every enclosing table first.
+	block := ""
+	blockLines := strings.SplitAfter(string(encoded), "\n")
+	for i, headers := 0, 0; i < len(blockLines); i++ {
+		if _, _, ok := tomlHeader(blockLines[i]); ok {
+			if headers++; headers == len(path) {
+				block = strings.Join(blockLines[i:], "")
+				break
+			}
+		}
+	}
+	if block == "" {
+		return nil, false
+	}
+
+	block = strings.TrimRight(block, "\n") + "\n"
+
+	lines := strings.SplitAfter(string(content), "\n")
+	var out strings.Builder
+	// needBlank is set after the block, which a blank line separates from
+	// what follows it.
+	replaced, needBlank := false, false
+	write := func(line string) {
+		blank := strings.TrimSpace(line) == ""
+		if blank && strings.HasSuffix(out.String(), "\n\n") {
+			return
+		}
+		if needBlank && !blank {
+			out.WriteString("\n")
+		}
+		needBlank = false
+		out.WriteString(line)
+	}
+	for i := 0; i < len(lines); {
+		parts, array, ok := tomlHeader(lines[i])
+		if !ok || !hasKeyPrefix(parts, path) {
+			write(lines[i])
+			i++
+			continue
+		}
+		if array {
+			return nil, false
+		}
+		// The table runs to the next header; comments and blank lines
+		// before that header belong to what follows.
+		end := i + 1
+		for end < len(lines) {
+			if _, _, ok := tomlHeader(lines[end]); ok {
+				break
+			}
+			end++
+		}
+		keep := end
+		for keep > i+1 {
+			trimmed := strings.TrimSpace(lines[keep-1])
+			if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+				break
+			}
+			keep--
+		}
+		if !replaced {
+			out.WriteString(block)
+			replaced, needBlank = true, true
+		}
+		for _, line := range lines[keep:end] {
+			write(line)
+		}
+		i = end
+	}
+	if !replaced {
+		if out.Len() > 0 && !strings.HasSuffix(out.String(), "\n") {
+			out.WriteString("\n")
+		}
+		if out.Len() > 0 && !strings.HasSuffix(out.String(), "\n\n") {
+			out.WriteString("\n")
+		}
+		out.WriteString(block)
+	}
+	return []byte(out.String()), true
+}
+
+// tomlHeader parses a [table] or [[array]] header line into its keys.
+func tomlHeader(line string) (keys []string, array, ok bool) {
+	rest := strings.TrimSpace(line)
+	if !strings.HasPrefix(rest, "[") {
+		return nil, false, false
+	}
+	array = strings.HasPrefix(rest, "[[")
+	rest = strings.TrimPrefix(rest[1:], "[")
+	for {
+		rest = strings.TrimLeft(rest, " \t")
+		var key string
+		switch {
+		case strings.HasPrefix(rest, `"`):
+			end := 1
+			for end < len(rest) && rest[end] != '"' {
+				if rest[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(rest) {
+				return nil, false, false
+			}
+			unquoted, err := strconv.Unquote(rest[:end+1])
+			if err != nil {
+				return nil, false, false
+			}
+			key, rest = unquoted, rest[end+1:]
+		case strings.HasPrefix(rest, "'"):
+			end := strings.IndexByte(rest[1:], '\'')
+			if end < 0 {
+				return nil, false, false
+			}
+			key, rest = rest[1:end+1], rest[end+2:]
+		default:
+			end := 0
+			for end < len(rest) && (rest[end] == '_' || rest[end] == '-' ||
+				'a' <= rest[end] && rest[end] <= 'z' || 'A' <= rest[end] && rest[end] <= 'Z' || '0' <= rest[end] && rest[end] <= '9') {
+				end++
+			}
+			if end == 0 {
+				return nil, false, false
+			}
+			key, rest = rest[:end], rest[end:]
+		}
+		keys = append(keys, key)
+		rest = strings.TrimLeft(rest, " \t")
+		switch {
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+		case strings.HasPrefix(rest, "]"):
+			return keys, array, true
+		default:
+			return nil, false, false
+		}
+	}
+}
+
+func hasKeyPrefix(keys, prefix []string) bool {
+	if len(keys) < len(prefix) {
+		return false
+	}
+	for i, key := range prefix {
+		if keys[i] != key {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"join": func(sep string, v interface{}) (string, error) {
+		joined, _, err := filterJoin(v, true, []interface{}{sep})
+		if err != nil {
+			return "", err
+		}
+		return joined.(string), nil
+	},
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"basename": filepath.Base,
+	"default": func(fallback, v interface{}) interface{} {
+		if v == nil || v == "" {
+			return fallback
+		}
+		return v
+	},
+	"last": func(i int, list interface{}) bool {
+		return i == reflect.ValueOf(list).Len()-1
+	},
+}
+
+// RenderTemplate renders a template adapter with Go's text/template. The
+// template sees the globals (vars, repo_root, output_dir, home, os) along
+// with "tool" and "servers", the selected server definitions sorted by name.
+// The output is parsed back according to the adapter's format_type so that
+// a broken template fails generation instead of producing a broken file.
+func RenderTemplate(adapter AdapterConfig, servers map[string]ServerConfig, globals Globals) ([]byte, error) {
+	names, err := adapter.selectedServers(servers)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make([]ServerConfig, 0, len(names))
+	for _, name := range names {
+		serverConfig, err := adapter.resolveServer(name, servers, globals)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", adapter.describe(), err)
+		}
+		selected = append(selected, serverConfig)
+	}
+
+	templatePath := adapter.Template
+	if !filepath.IsAbs(templatePath) && adapter.Source != "" {
+		templatePath = filepath.Join(filepath.Dir(adapter.Source), templatePath)
+	}
+	text, err := os.ReadFile(templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to read template: %w", adapter.describe(), err)
+	}
+
+	tmpl, err := template.New(filepath.Base(templatePath)).Funcs(templateFuncs).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to parse template: %w", adapter.describe(), err)
+	}
+
+	data := make(map[string]interface{}, len(globals)+2)
+	for k, v := range globals {
+		data[k] = v
+	}
+	data["tool"] = adapter.Tool
+	data["servers"] = selected
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, fmt.Errorf("%s: failed to render template: %w", adapter.describe(), err)
+	}
+
+	if err := validateRendered(out.Bytes(), adapter.FormatType); err != nil {
+		return nil, fmt.Errorf("%s: template output is not valid %s: %w", adapter.describe(), adapter.formatType(), err)
+	}
+	return out.Bytes(), nil
+}
+
+func validateRendered(content []byte, formatType string) error {
+	format, err := LookupFormat(formatType)
+	if err != nil {
+		return err
+	}
+	_, err = format.Decode(content)
+	return err
+}
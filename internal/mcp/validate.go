@@ -0,0 +1,197 @@
+package mcp
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// authFields are the canonical fields of an "oauth" auth block, besides
+// "type". All are optional: servers supporting dynamic client registration
+// need no client_id.
+var authFields = map[string]bool{
+	"client_id":         true,
+	"client_secret":     true,
+	"scopes":            true,
+	"authorization_url": true,
+	"token_url":         true,
+	"redirect_uri":      true,
+}
+
+// validateServerFields checks the optional canonical fields shared by all
+// transports. Unknown fields are left alone so that adapters can map them.
+func validateServerFields(name string, config ServerConfig) error {
+	if cwd, ok := config["cwd"]; ok {
+		if _, ok := cwd.(string); !ok {
+			return fmt.Errorf("server '%s': 'cwd' must be a string", name)
+		}
+	}
+
+	if enabled, ok := config["enabled"]; ok {
+		if _, ok := enabled.(bool); !ok {
+			return fmt.Errorf("server '%s': 'enabled' must be true or false", name)
+		}
+	}
+
+	if timeouts, ok := config["timeouts"]; ok {
+		fields, ok := timeouts.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("server '%s': 'timeouts' must be an object", name)
+		}
+		for key, value := range fields {
+			if key != "startup_ms" && key != "tool_call_ms" {
+				return fmt.Errorf("server '%s': unknown field 'timeouts.%s' (expected startup_ms or tool_call_ms)", name, key)
+			}
+			if ms, ok := value.(float64); !ok || ms <= 0 {
+				return fmt.Errorf("server '%s': 'timeouts.%s' must be a positive number of milliseconds", name, key)
+			}
+		}
+	}
+
+	if tools, ok := config["tools"]; ok {
+		fields, ok := tools.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("server '%s': 'tools' must be an object", name)
+		}
+		for key, value := range fields {
+			if key != "include" && key != "exclude" {
+				return fmt.Errorf("server '%s': unknown field 'tools.%s' (expected include or exclude)", name, key)
+			}
+			if !isStringList(value) {
+				return fmt.Errorf("server '%s': 'tools.%s' must be a list of tool names", name, key)
+			}
+		}
+	}
+
+	if prefix, ok := config["tool_prefix"]; ok {
+		if _, ok := prefix.(string); !ok {
+			return fmt.Errorf("server '%s': 'tool_prefix' must be a string", name)
+		}
+	}
+
+	if aliases, ok := config["tool_aliases"]; ok {
+		if err := validateToolAliases(name, aliases); err != nil {
+			return err
+		}
+	}
+
+	if approval, ok := config["approval"]; ok {
+		if err := validateApproval(name, approval); err != nil {
+			return err
+		}
+	}
+
+	if auth, ok := config["auth"]; ok {
+		if err := validateAuth(name, config, auth); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateApproval(name string, approval interface{}) error {
+	fields, ok := approval.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("server '%s': 'approval' must be an object", name)
+	}
+	for key, value := range fields {
+		switch key {
+		case "always_ask", "trusted":
+			if _, ok := value.(bool); !ok {
+				return fmt.Errorf("server '%s': 'approval.%s' must be true or false", name, key)
+			}
+		case "auto_approve_tools":
+			if !isStringList(value) {
+				return fmt.Errorf("server '%s': 'approval.auto_approve_tools' must be a list of tool names", name)
+			}
+		default:
+			return fmt.Errorf("server '%s': unknown field 'approval.%s' (expected always_ask, trusted or auto_approve_tools)", name, key)
+		}
+	}
+
+	if fields["always_ask"] == true && (fields["trusted"] == true || len(asList(fields["auto_approve_tools"])) > 0) {
+		return fmt.Errorf("server '%s': 'approval.always_ask' conflicts with 'trusted' and 'auto_approve_tools'", name)
+	}
+	return nil
+}
+
+// validateToolAliases checks that tool_aliases maps tool names to distinct,
+// non-empty names.
+func validateToolAliases(name string, aliases interface{}) error {
+	fields, ok := aliases.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("server '%s': 'tool_aliases' must be an object mapping tool names to new names", name)
+	}
+	seen := map[string]string{}
+	for tool, value := range fields {
+		alias, ok := value.(string)
+		if !ok || alias == "" {
+			return fmt.Errorf("server '%s': 'tool_aliases.%s' must be a non-empty string", name, tool)
+		}
+		if other, ok := seen[alias]; ok {
+			first, second := other, tool
+			if second < first {
+				first, second = second, first
+			}
+			return fmt.Errorf("server '%s': tools '%s' and '%s' are both aliased to '%s'", name, first, second, alias)
+		}
+		seen[alias] = tool
+	}
+	return nil
+}
+
+func validateAuth(name string, config ServerConfig, auth interface{}) error {
+	if transport := config["transport"]; transport != "http" && transport != "sse" {
+		return fmt.Errorf("server '%s': 'auth' requires an http or sse transport", name)
+	}
+	fields, ok := auth.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("server '%s': 'auth' must be an object", name)
+	}
+	if fields["type"] != "oauth" {
+		return fmt.Errorf("server '%s': unsupported 'auth.type' %v (expected \"oauth\")", name, fields["type"])
+	}
+
+	for key, value := range fields {
+		switch {
+		case key == "type":
+		case key == "scopes":
+			if !isStringList(value) {
+				return fmt.Errorf("server '%s': 'auth.scopes' must be a list of scopes", name)
+			}
+		case authFields[key]:
+			s, ok := value.(string)
+			if !ok || s == "" {
+				return fmt.Errorf("server '%s': 'auth.%s' must be a non-empty string", name, key)
+			}
+			// URLs are checked once placeholders such as {{vars.host}} are gone.
+			if (key == "authorization_url" || key == "token_url" || key == "redirect_uri") && !strings.Contains(s, "{{") {
+				if u, err := url.Parse(s); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return fmt.Errorf("server '%s': 'auth.%s' must be an http(s) URL", name, key)
+				}
+			}
+		default:
+			return fmt.Errorf("server '%s': unknown field 'auth.%s'", name, key)
+		}
+	}
+	return nil
+}
+
+func isStringList(value interface{}) bool {
+	list, ok := value.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, item := range list {
+		if _, ok := item.(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func asList(value interface{}) []interface{} {
+	list, _ := value.([]interface{})
+	return list
+}
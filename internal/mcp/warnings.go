@@ -0,0 +1,168 @@
+package mcp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// canonicalSettings are the optional server fields that not every client can
+// express. A mapping that never refers to one of them (or to an enclosing
+// field such as "timeouts") means the client will not honour it.
+var canonicalSettings = []string{
+	"timeouts.startup_ms",
+	"timeouts.tool_call_ms",
+	"tools.include",
+	"tools.exclude",
+	"auth",
+	"approval.trusted",
+	"approval.auto_approve_tools",
+	"approval.always_ask",
+}
+
+// settingPresets names, per client, the preset that writes settings the
+// client keeps outside its server configuration.
+var settingPresets = map[string]map[string]string{
+	"claude": {"approval": "claude-settings"},
+}
+
+// Warnings reports canonical settings of the targeted servers that the
+// adapter's mapping has no equivalent for. Template and exec adapters receive
+// the full server definitions and are not checked.
+func Warnings(adapter AdapterConfig, servers map[string]ServerConfig, globals Globals) ([]string, error) {
+	if adapter.Type == "exec" || adapter.Template != "" {
+		return nil, nil
+	}
+
+	names, err := adapter.selectedServers(servers)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	for _, name := range names {
+		serverConfig, err := adapter.resolveServer(name, servers, globals)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", adapter.describe(), err)
+		}
+		mapping, _, mapped, err := selectMapping(adapter, name, serverConfig)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", adapter.describe(), err)
+		}
+
+		if transport, _ := serverConfig["transport"].(string); mapped["transport"] != transport {
+			launcher := "mcp-bridge proxy"
+			if _, hasAuth := serverConfig["auth"]; hasAuth {
+				launcher = "mcp-remote"
+			}
+			reason := "OAuth, which " + adapter.Tool + " cannot run itself"
+			if !adapter.supportsTransport(transport) {
+				reason = fmt.Sprintf("transport '%s', which %s does not support", transport, adapter.Tool)
+			}
+			warnings = append(warnings, fmt.Sprintf("%s: server '%s' uses %s; it is launched through %s", adapter.describe(), name, reason, launcher))
+		}
+
+		for _, setting := range canonicalSettings {
+			if settingsRenderers[adapter.Renderer] {
+				break
+			}
+			path, _ := parsePath(setting)
+			// false is every client's default and needs no setting.
+			if value, ok := lookup(map[string]interface{}(mapped), path); !ok || value == false {
+				continue
+			}
+			if adapter.handles(setting, mapping) {
+				continue
+			}
+			if preset, ok := settingPresets[adapter.Tool][strings.Split(setting, ".")[0]]; ok {
+				warnings = append(warnings, fmt.Sprintf("%s: server '%s' sets '%s', which %s reads from its settings; add an adapter with the '%s' preset to write it", adapter.describe(), name, setting, adapter.Tool, preset))
+				continue
+			}
+			warnings = append(warnings, fmt.Sprintf("%s: server '%s' sets '%s' but %s has no equivalent setting; it is ignored", adapter.describe(), name, setting, adapter.Tool))
+		}
+	}
+	return warnings, nil
+}
+
+// handles reports whether the adapter renders setting, either because the
+// mapping refers to it (or to an enclosing field such as "timeouts") or
+// because the adapter's renderer writes it.
+func (a AdapterConfig) handles(setting string, mapping map[string]interface{}) bool {
+	for _, field := range rendererSettings[a.Renderer] {
+		if field == setting || strings.HasPrefix(setting, field+".") {
+			return true
+		}
+	}
+
+	referenced := map[string]bool{}
+	if err := collectPaths(mapping, referenced); err != nil {
+		// Broken placeholders are reported by lint and generation.
+		return true
+	}
+	for {
+		if referenced[setting] {
+			return true
+		}
+		dot := strings.LastIndex(setting, ".")
+		if dot < 0 {
+			return false
+		}
+		setting = setting[:dot]
+	}
+}
+
+// collectPaths records the path of every placeholder in value, e.g.
+// "timeouts.startup_ms" for "{{timeouts.startup_ms | div 1000}}".
+func collectPaths(value interface{}, paths map[string]bool) error {
+	switch v := value.(type) {
+	case string:
+		rest := v
+		for {
+			start := strings.Index(rest, "{{")
+			if start < 0 {
+				return nil
+			}
+			if start > 0 && rest[start-1] == '\\' {
+				rest = rest[start+2:]
+				continue
+			}
+			end := findClose(rest, start+2)
+			if end < 0 {
+				return fmt.Errorf("unterminated placeholder in '%s'", v)
+			}
+			p, err := parsePlaceholder(rest[start : end+2])
+			if err != nil {
+				return err
+			}
+			paths[pathString(p.path)] = true
+			rest = rest[end+2:]
+		}
+	case map[string]interface{}:
+		for _, val := range v {
+			if err := collectPaths(val, paths); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, val := range v {
+			if err := collectPaths(val, paths); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func pathString(path []pathElem) string {
+	var b strings.Builder
+	for i, elem := range path {
+		switch {
+		case elem.isIdx:
+			fmt.Fprintf(&b, "[%d]", elem.index)
+		case i > 0:
+			b.WriteString("." + elem.key)
+		default:
+			b.WriteString(elem.key)
+		}
+	}
+	return b.String()
+}